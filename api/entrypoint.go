@@ -31,7 +31,7 @@ func init() {
 	cfg = config.LoadConfig()
 
 	// Initialize the router
-	app = service.Router(cfg)
+	app = service.Router(service.NewService(cfg))
 }
 
 // Entrypoint is the serverless function handler for Vercel
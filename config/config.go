@@ -15,8 +15,12 @@ package config
 import (
 	"fmt"
 	"log"
+	"net"
+	"net/url"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -27,6 +31,37 @@ type Config struct {
 	DatabaseURL   string
 	Port          int
 	IsDevelopment bool
+	// ProbeInterval is how often nodes are health checked, 0 disables probing
+	ProbeInterval time.Duration
+	// ProbeTimeout bounds each TCP connection attempt of a health check
+	ProbeTimeout time.Duration
+	// UnhealthyAfter is how long a node must keep failing probes before
+	// it is considered unhealthy
+	UnhealthyAfter time.Duration
+	// HealthyOnly drops unhealthy nodes from subscriptions by default
+	HealthyOnly bool
+	// GeoIPProviders lists the geolocation providers in fallback order
+	GeoIPProviders []string
+	// GeoIPCountryDB and GeoIPASNDB are the mmdb files of the offline provider
+	GeoIPCountryDB string
+	GeoIPASNDB     string
+	// GeoRetryInterval is how often failed geolocation lookups are
+	// retried, 0 disables retrying
+	GeoRetryInterval time.Duration
+	// GeoMaxAttempts is how many lookups are tried before giving up
+	GeoMaxAttempts int
+	// ResolveInterval is how often domain entries are re-resolved, 0
+	// disables re-resolution
+	ResolveInterval time.Duration
+	// NameTemplate is the default node name template of subscriptions,
+	// the built-in naming when empty
+	NameTemplate string
+	// PublicURL is the scheme and host that generated links point to,
+	// detected from each request when empty
+	PublicURL string
+	// TrustedProxies are the networks of the reverse proxies whose
+	// X-Forwarded-Proto header is honored
+	TrustedProxies []*net.IPNet
 }
 
 // LoadConfig loads configuration from environment variables and .env file
@@ -61,12 +96,129 @@ func LoadConfig() *Config {
 	// Check if we're in development mode
 	isDev := os.Getenv("ENV") == "development"
 
+	// Prefer the offline databases when configured, ip.sb otherwise
+	countryDB := os.Getenv("GEOIP_COUNTRY_DB")
+	asnDB := os.Getenv("GEOIP_ASN_DB")
+	providers := os.Getenv("GEOIP_PROVIDERS")
+	if providers == "" {
+		providers = "ipsb"
+		if countryDB != "" || asnDB != "" {
+			providers = "mmdb,ipsb"
+		}
+	}
+
 	return &Config{
-		ApiToken:      apiToken,
-		DatabaseURL:   dbURL,
-		Port:          port,
-		IsDevelopment: isDev,
+		ApiToken:         apiToken,
+		DatabaseURL:      dbURL,
+		Port:             port,
+		IsDevelopment:    isDev,
+		ProbeInterval:    getDuration("PROBE_INTERVAL", time.Minute),
+		ProbeTimeout:     getDuration("PROBE_TIMEOUT", 5*time.Second),
+		UnhealthyAfter:   getDuration("UNHEALTHY_AFTER", 30*time.Minute),
+		HealthyOnly:      os.Getenv("SUBSCRIBE_HEALTHY_ONLY") == "true",
+		GeoIPProviders:   strings.Split(providers, ","),
+		GeoIPCountryDB:   countryDB,
+		GeoIPASNDB:       asnDB,
+		GeoRetryInterval: getDuration("GEO_RETRY_INTERVAL", time.Minute),
+		GeoMaxAttempts:   getInt("GEO_MAX_ATTEMPTS", 10),
+		ResolveInterval:  getDuration("RESOLVE_INTERVAL", 10*time.Minute),
+		NameTemplate:     os.Getenv("NAME_TEMPLATE"),
+		PublicURL:        getPublicURL("PUBLIC_URL"),
+		TrustedProxies:   getNetworks("TRUSTED_PROXIES", defaultTrustedProxies()),
+	}
+}
+
+// defaultTrustedProxies trusts local reverse proxies, and every address
+// on Vercel where requests can only arrive through its proxy
+func defaultTrustedProxies() string {
+	if os.Getenv("VERCEL") != "" {
+		return "0.0.0.0/0,::/0"
+	}
+	return "127.0.0.0/8,::1/128"
+}
+
+// getPublicURL loads an http or https base URL from an environment
+// variable, ignoring it when invalid
+func getPublicURL(key string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		return ""
+	}
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		log.Printf("Invalid %s value: %s, detecting it from requests", key, value)
+		return ""
+	}
+	return u.Scheme + "://" + u.Host + strings.TrimSuffix(u.Path, "/")
+}
+
+// getNetworks loads a comma-separated list of IP addresses and CIDR
+// networks from an environment variable, falling back to the default
+// list when unset or invalid
+func getNetworks(key, defaultValue string) []*net.IPNet {
+	value := os.Getenv(key)
+	if value != "" {
+		networks, err := parseNetworks(value)
+		if err == nil {
+			return networks
+		}
+		log.Printf("Invalid %s value: %v, using default: %s", key, err, defaultValue)
+	}
+	networks, _ := parseNetworks(defaultValue)
+	return networks
+}
+
+// parseNetworks parses a comma-separated list of IP addresses and CIDR
+// networks, an address standing for a network of its own
+func parseNetworks(value string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if ip := net.ParseIP(item); ip != nil {
+			bits := 128
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an IP address or CIDR network", item)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// getDuration loads a duration such as "30s" or "5m" from an environment
+// variable, falling back to the default value when unset or invalid
+func getDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < 0 {
+		log.Printf("Invalid %s value: %s, using default: %s", key, value, defaultValue)
+		return defaultValue
+	}
+	return duration
+}
+
+// getInt loads a positive integer from an environment variable, falling
+// back to the default value when unset or invalid
+func getInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil || number <= 0 {
+		log.Printf("Invalid %s value: %s, using default: %d", key, value, defaultValue)
+		return defaultValue
 	}
+	return number
 }
 
 // GetPortString returns the port string for HTTP serving
@@ -0,0 +1,56 @@
+/*
+ * @Author: Vincent Yang
+ * @Date: 2026-10-17 19:21:05
+ * @LastEditors: Vincent Yang
+ * @LastEditTime: 2026-10-17 19:21:05
+ * @FilePath: /snell-panel/database/geo.go
+ * @Telegram: https://t.me/missuo
+ * @GitHub: https://github.com/missuo
+ *
+ * Copyright © 2026 by Vincent, All Rights Reserved.
+ */
+
+package database
+
+import (
+	"time"
+
+	"snell-panel/models"
+)
+
+// GeoRepository defines the storage operations for geolocation enrichment
+type GeoRepository interface {
+	// ListGeoPending returns the entries whose pending lookup is due by now
+	ListGeoPending(now time.Time) ([]models.Entry, error)
+	// SaveGeo saves the addresses and geolocation fields of an entry, matched by node ID
+	// and address so a lookup never overwrites a newer address. It returns
+	// models.ErrNotFound when the entry was deleted or its address changed.
+	SaveGeo(entry *models.Entry) error
+}
+
+// ListGeoPending returns the entries whose pending lookup is due by now
+func (r *sqlRepository) ListGeoPending(now time.Time) ([]models.Entry, error) {
+	return r.queryEntries(entrySelect+`
+		 WHERE e.geo_status = $1 AND (e.geo_retry_at IS NULL OR e.geo_retry_at <= $2)
+		 ORDER BY e.id`,
+		models.GeoStatusPending, now)
+}
+
+// SaveGeo saves the geolocation fields of an entry
+func (r *sqlRepository) SaveGeo(entry *models.Entry) error {
+	entry.UpdatedAt = time.Now().UTC()
+	result, err := r.db.Exec(`
+		 UPDATE entries
+		 SET country_code = $1, isp = $2, asn = $3,
+			geo_status = $4, geo_error = $5, geo_attempts = $6, geo_retry_at = $7,
+			ipv4 = $8, ipv6 = $9, ipv6_country_code = $10, ipv6_isp = $11, ipv6_asn = $12, updated_at = $13
+		 WHERE node_id = $14 AND ip = $15`,
+		entry.CountryCode, entry.ISP, entry.ASN,
+		entry.GeoStatus, entry.GeoError, entry.GeoAttempts, entry.GeoRetryAt,
+		entry.IPv4, entry.IPv6, entry.IPv6CountryCode, entry.IPv6ISP, entry.IPv6ASN, entry.UpdatedAt,
+		entry.NodeID, entry.IP)
+	if err != nil {
+		return err
+	}
+	return checkAffected(result)
+}
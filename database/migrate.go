@@ -0,0 +1,231 @@
+/*
+ * @Author: Vincent Yang
+ * @Date: 2026-10-17 15:02:44
+ * @LastEditors: Vincent Yang
+ * @LastEditTime: 2026-10-17 15:02:44
+ * @FilePath: /snell-panel/database/migrate.go
+ * @Telegram: https://t.me/missuo
+ * @GitHub: https://github.com/missuo
+ *
+ * Copyright © 2026 by Vincent, All Rights Reserved.
+ */
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// migrationLockKey identifies the Postgres advisory lock held while
+// migrating, so concurrent cold starts apply migrations one at a time
+const migrationLockKey int64 = 0x736e656c6c // "snell"
+
+// Migration is a single versioned schema change
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *sql.Tx, driver Driver) error
+	Down    func(tx *sql.Tx, driver Driver) error
+}
+
+// MigrationStatus reports whether a migration has been applied
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+// Migrator applies and rolls back the registered migrations
+type Migrator struct {
+	db         *sql.DB
+	driver     Driver
+	migrations []Migration
+}
+
+// NewMigrator creates a Migrator for the registered migrations
+func NewMigrator(db *sql.DB, driver Driver) *Migrator {
+	return &Migrator{
+		db:         db,
+		driver:     driver,
+		migrations: migrations,
+	}
+}
+
+// Up applies every pending migration in version order and returns them
+func (m *Migrator) Up() ([]Migration, error) {
+	var applied []Migration
+	err := m.withLock(func(ctx context.Context, conn *sql.Conn) error {
+		appliedAt, err := m.appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if _, ok := appliedAt[migration.Version]; ok {
+				continue
+			}
+			err := m.inTx(ctx, conn, func(tx *sql.Tx) error {
+				if err := migration.Up(tx, m.driver); err != nil {
+					return err
+				}
+				_, err := tx.ExecContext(ctx,
+					"INSERT INTO schema_migrations (version, name) VALUES ($1, $2)",
+					migration.Version, migration.Name)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d_%s failed: %w", migration.Version, migration.Name, err)
+			}
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down rolls back the given number of most recently applied migrations
+// and returns them in the order they were rolled back
+func (m *Migrator) Down(steps int) ([]Migration, error) {
+	var rolledBack []Migration
+	err := m.withLock(func(ctx context.Context, conn *sql.Conn) error {
+		appliedAt, err := m.appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && len(rolledBack) < steps; i-- {
+			migration := m.migrations[i]
+			if _, ok := appliedAt[migration.Version]; !ok {
+				continue
+			}
+			err := m.inTx(ctx, conn, func(tx *sql.Tx) error {
+				if err := migration.Down(tx, m.driver); err != nil {
+					return err
+				}
+				_, err := tx.ExecContext(ctx,
+					"DELETE FROM schema_migrations WHERE version = $1", migration.Version)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("rollback of migration %d_%s failed: %w", migration.Version, migration.Name, err)
+			}
+			rolledBack = append(rolledBack, migration)
+		}
+		return nil
+	})
+	return rolledBack, err
+}
+
+// Status lists every registered migration and when it was applied
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	var statuses []MigrationStatus
+	err := m.withLock(func(ctx context.Context, conn *sql.Conn) error {
+		appliedAt, err := m.appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			status := MigrationStatus{
+				Version: migration.Version,
+				Name:    migration.Name,
+			}
+			if at, ok := appliedAt[migration.Version]; ok {
+				status.AppliedAt = &at
+			}
+			statuses = append(statuses, status)
+		}
+		return nil
+	})
+	return statuses, err
+}
+
+// withLock runs fn on a dedicated connection holding the migration lock
+// and makes sure the schema_migrations table exists
+func (m *Migrator) withLock(fn func(ctx context.Context, conn *sql.Conn) error) error {
+	ctx := context.Background()
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// Advisory locks are session scoped, so lock and unlock on the same connection
+	if m.driver == DriverPostgres {
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockKey); err != nil {
+			return fmt.Errorf("failed to acquire migration lock: %w", err)
+		}
+		defer conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", migrationLockKey)
+	}
+
+	_, err = conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	return fn(ctx, conn)
+}
+
+// appliedVersions returns the applied migration versions and their timestamps
+func (m *Migrator) appliedVersions(ctx context.Context, conn *sql.Conn) (map[int]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+
+	return applied, rows.Err()
+}
+
+// inTx runs fn in a transaction on conn
+func (m *Migrator) inTx(ctx context.Context, conn *sql.Conn, fn func(tx *sql.Tx) error) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// execQuerier is implemented by both *sql.DB and *sql.Tx
+type execQuerier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// execAll executes statements in order, stopping at the first error
+func execAll(tx *sql.Tx, statements ...string) error {
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// noop is used for migration steps that have nothing to do
+func noop(tx *sql.Tx, driver Driver) error {
+	return nil
+}
@@ -0,0 +1,583 @@
+/*
+ * @Author: Vincent Yang
+ * @Date: 2026-10-17 15:02:44
+ * @LastEditors: Vincent Yang
+ * @LastEditTime: 2026-10-17 15:02:44
+ * @FilePath: /snell-panel/database/migrations.go
+ * @Telegram: https://t.me/missuo
+ * @GitHub: https://github.com/missuo
+ *
+ * Copyright © 2026 by Vincent, All Rights Reserved.
+ */
+
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"snell-panel/models"
+
+	"github.com/lib/pq"
+)
+
+// migrations is the ordered list of schema changes. Never edit or reorder
+// an existing migration, append a new one instead.
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "create_entries",
+		Up: func(tx *sql.Tx, driver Driver) error {
+			if driver == DriverSQLite {
+				return execAll(tx, `
+					CREATE TABLE IF NOT EXISTS entries (
+						id INTEGER PRIMARY KEY AUTOINCREMENT,
+						ip TEXT,
+						port INTEGER,
+						psk TEXT,
+						country_code TEXT,
+						isp TEXT,
+						asn INTEGER,
+						node_id TEXT UNIQUE,
+						node_name TEXT,
+						version TEXT DEFAULT '4'
+					)
+				`)
+			}
+			// Installations that predate versioning already have the table,
+			// possibly without the version column
+			return execAll(tx, `
+				CREATE TABLE IF NOT EXISTS entries (
+					id SERIAL PRIMARY KEY,
+					ip TEXT,
+					port INTEGER,
+					psk TEXT,
+					country_code TEXT,
+					isp TEXT,
+					asn INTEGER,
+					node_id TEXT UNIQUE,
+					node_name TEXT,
+					version TEXT DEFAULT '4'
+				)
+			`, `
+				ALTER TABLE entries ADD COLUMN IF NOT EXISTS version TEXT DEFAULT '4'
+			`)
+		},
+		Down: func(tx *sql.Tx, driver Driver) error {
+			return execAll(tx, "DROP TABLE entries")
+		},
+	},
+	{
+		Version: 2,
+		Name:    "drop_entries_ip_unique",
+		Up: func(tx *sql.Tx, driver Driver) error {
+			// Only early Postgres installations created entries with UNIQUE (ip)
+			if driver != DriverPostgres {
+				return nil
+			}
+
+			// Look the constraint up by the column it covers instead of guessing its name
+			rows, err := tx.Query(`
+				SELECT con.conname
+				FROM pg_constraint con
+				JOIN pg_class rel ON rel.oid = con.conrelid
+				JOIN pg_namespace nsp ON nsp.oid = rel.relnamespace
+				JOIN pg_attribute att ON att.attrelid = rel.oid AND att.attnum = ANY(con.conkey)
+				WHERE nsp.nspname = current_schema()
+				AND rel.relname = 'entries'
+				AND con.contype = 'u'
+				AND att.attname = 'ip'
+				AND array_length(con.conkey, 1) = 1
+			`)
+			if err != nil {
+				return err
+			}
+			var names []string
+			for rows.Next() {
+				var name string
+				if err := rows.Scan(&name); err != nil {
+					rows.Close()
+					return err
+				}
+				names = append(names, name)
+			}
+			rows.Close()
+			if err := rows.Err(); err != nil {
+				return err
+			}
+
+			for _, name := range names {
+				if err := execAll(tx, "ALTER TABLE entries DROP CONSTRAINT "+pq.QuoteIdentifier(name)); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(tx *sql.Tx, driver Driver) error {
+			if driver != DriverPostgres {
+				return nil
+			}
+			return execAll(tx, "ALTER TABLE entries ADD CONSTRAINT entries_ip_key UNIQUE (ip)")
+		},
+	},
+	{
+		Version: 3,
+		Name:    "reset_entries_id_sequence",
+		Up: func(tx *sql.Tx, driver Driver) error {
+			// Rows imported with explicit ids leave the sequence behind MAX(id)
+			if driver != DriverPostgres {
+				return nil
+			}
+			return execAll(tx, `
+				SELECT setval(pg_get_serial_sequence('entries', 'id'), COALESCE(MAX(id), 0) + 1, false)
+				FROM entries
+			`)
+		},
+		Down: noop,
+	},
+	{
+		Version: 4,
+		Name:    "create_tokens",
+		Up: func(tx *sql.Tx, driver Driver) error {
+			if driver == DriverSQLite {
+				return execAll(tx, `
+					CREATE TABLE tokens (
+						id INTEGER PRIMARY KEY AUTOINCREMENT,
+						name TEXT NOT NULL,
+						token_hash TEXT NOT NULL UNIQUE,
+						prefix TEXT NOT NULL,
+						scopes TEXT NOT NULL,
+						expires_at TIMESTAMP,
+						created_at TIMESTAMP NOT NULL
+					)
+				`)
+			}
+			return execAll(tx, `
+				CREATE TABLE tokens (
+					id SERIAL PRIMARY KEY,
+					name TEXT NOT NULL,
+					token_hash TEXT NOT NULL UNIQUE,
+					prefix TEXT NOT NULL,
+					scopes TEXT NOT NULL,
+					expires_at TIMESTAMPTZ,
+					created_at TIMESTAMPTZ NOT NULL
+				)
+			`)
+		},
+		Down: func(tx *sql.Tx, driver Driver) error {
+			return execAll(tx, "DROP TABLE tokens")
+		},
+	},
+	{
+		Version: 5,
+		Name:    "create_node_status",
+		Up: func(tx *sql.Tx, driver Driver) error {
+			timestamp := "TIMESTAMPTZ"
+			if driver == DriverSQLite {
+				timestamp = "TIMESTAMP"
+			}
+			return execAll(tx, `
+				CREATE TABLE node_status (
+					node_id TEXT PRIMARY KEY REFERENCES entries (node_id) ON DELETE CASCADE,
+					status TEXT NOT NULL,
+					latency_ms INTEGER,
+					last_seen `+timestamp+`,
+					last_checked `+timestamp+` NOT NULL,
+					last_error TEXT NOT NULL DEFAULT ''
+				)
+			`)
+		},
+		Down: func(tx *sql.Tx, driver Driver) error {
+			return execAll(tx, "DROP TABLE node_status")
+		},
+	},
+	{
+		Version: 6,
+		Name:    "add_node_status_failing_since",
+		Up: func(tx *sql.Tx, driver Driver) error {
+			timestamp := "TIMESTAMPTZ"
+			if driver == DriverSQLite {
+				timestamp = "TIMESTAMP"
+			}
+			return execAll(tx,
+				"ALTER TABLE node_status ADD COLUMN failing_since "+timestamp,
+				"UPDATE node_status SET failing_since = last_checked WHERE status = 'down'",
+			)
+		},
+		Down: func(tx *sql.Tx, driver Driver) error {
+			return execAll(tx, "ALTER TABLE node_status DROP COLUMN failing_since")
+		},
+	},
+	{
+		Version: 7,
+		Name:    "add_entries_geo_status",
+		Up: func(tx *sql.Tx, driver Driver) error {
+			timestamp := "TIMESTAMPTZ"
+			if driver == DriverSQLite {
+				timestamp = "TIMESTAMP"
+			}
+			return execAll(tx,
+				"ALTER TABLE entries ADD COLUMN geo_status TEXT NOT NULL DEFAULT 'resolved'",
+				"ALTER TABLE entries ADD COLUMN geo_error TEXT NOT NULL DEFAULT ''",
+				"ALTER TABLE entries ADD COLUMN geo_attempts INTEGER NOT NULL DEFAULT 0",
+				"ALTER TABLE entries ADD COLUMN geo_retry_at "+timestamp,
+			)
+		},
+		Down: func(tx *sql.Tx, driver Driver) error {
+			return execAll(tx,
+				"ALTER TABLE entries DROP COLUMN geo_retry_at",
+				"ALTER TABLE entries DROP COLUMN geo_attempts",
+				"ALTER TABLE entries DROP COLUMN geo_error",
+				"ALTER TABLE entries DROP COLUMN geo_status",
+			)
+		},
+	},
+	{
+		Version: 8,
+		Name:    "add_entry_resolutions",
+		Up: func(tx *sql.Tx, driver Driver) error {
+			timestamp, primaryKey := "TIMESTAMPTZ", "SERIAL PRIMARY KEY"
+			if driver == DriverSQLite {
+				timestamp, primaryKey = "TIMESTAMP", "INTEGER PRIMARY KEY AUTOINCREMENT"
+			}
+			return execAll(tx,
+				"ALTER TABLE entries ADD COLUMN resolved_ips TEXT NOT NULL DEFAULT ''",
+				"ALTER TABLE entries ADD COLUMN resolved_at "+timestamp,
+				"ALTER TABLE entries ADD COLUMN resolve_error TEXT NOT NULL DEFAULT ''",
+				"ALTER TABLE entries ADD COLUMN unresolvable_since "+timestamp,
+				`CREATE TABLE entry_resolutions (
+					id `+primaryKey+`,
+					node_id TEXT NOT NULL REFERENCES entries (node_id) ON DELETE CASCADE,
+					domain TEXT NOT NULL,
+					addresses TEXT NOT NULL,
+					error TEXT NOT NULL DEFAULT '',
+					resolved_at `+timestamp+` NOT NULL
+				)`,
+				"CREATE INDEX entry_resolutions_node_id ON entry_resolutions (node_id)",
+			)
+		},
+		Down: func(tx *sql.Tx, driver Driver) error {
+			return execAll(tx,
+				"DROP TABLE entry_resolutions",
+				"ALTER TABLE entries DROP COLUMN unresolvable_since",
+				"ALTER TABLE entries DROP COLUMN resolve_error",
+				"ALTER TABLE entries DROP COLUMN resolved_at",
+				"ALTER TABLE entries DROP COLUMN resolved_ips",
+			)
+		},
+	},
+	{
+		Version: 9,
+		Name:    "add_entries_dual_stack",
+		Up: func(tx *sql.Tx, driver Driver) error {
+			err := execAll(tx,
+				"ALTER TABLE entries ADD COLUMN ipv4 TEXT NOT NULL DEFAULT ''",
+				"ALTER TABLE entries ADD COLUMN ipv6 TEXT NOT NULL DEFAULT ''",
+				"ALTER TABLE entries ADD COLUMN ipv6_country_code TEXT NOT NULL DEFAULT ''",
+				"ALTER TABLE entries ADD COLUMN ipv6_isp TEXT NOT NULL DEFAULT ''",
+				"ALTER TABLE entries ADD COLUMN ipv6_asn INTEGER NOT NULL DEFAULT 0",
+			)
+			if err != nil {
+				return err
+			}
+			return backfillAddresses(tx)
+		},
+		Down: func(tx *sql.Tx, driver Driver) error {
+			return execAll(tx,
+				"ALTER TABLE entries DROP COLUMN ipv6_asn",
+				"ALTER TABLE entries DROP COLUMN ipv6_isp",
+				"ALTER TABLE entries DROP COLUMN ipv6_country_code",
+				"ALTER TABLE entries DROP COLUMN ipv6",
+				"ALTER TABLE entries DROP COLUMN ipv4",
+			)
+		},
+	},
+	{
+		Version: 10,
+		Name:    "add_entries_transport_options",
+		Up: func(tx *sql.Tx, driver Driver) error {
+			return execAll(tx,
+				"ALTER TABLE entries ADD COLUMN obfs TEXT NOT NULL DEFAULT ''",
+				"ALTER TABLE entries ADD COLUMN obfs_host TEXT NOT NULL DEFAULT ''",
+				"ALTER TABLE entries ADD COLUMN shadow_tls_password TEXT NOT NULL DEFAULT ''",
+				"ALTER TABLE entries ADD COLUMN shadow_tls_sni TEXT NOT NULL DEFAULT ''",
+				"ALTER TABLE entries ADD COLUMN shadow_tls_version INTEGER NOT NULL DEFAULT 0",
+				"ALTER TABLE entries ADD COLUMN shadow_tls_port INTEGER NOT NULL DEFAULT 0",
+				"ALTER TABLE entries ADD COLUMN tfo BOOLEAN NOT NULL DEFAULT FALSE",
+				"ALTER TABLE entries ADD COLUMN reuse BOOLEAN NOT NULL DEFAULT FALSE",
+			)
+		},
+		Down: func(tx *sql.Tx, driver Driver) error {
+			return execAll(tx,
+				"ALTER TABLE entries DROP COLUMN reuse",
+				"ALTER TABLE entries DROP COLUMN tfo",
+				"ALTER TABLE entries DROP COLUMN shadow_tls_port",
+				"ALTER TABLE entries DROP COLUMN shadow_tls_version",
+				"ALTER TABLE entries DROP COLUMN shadow_tls_sni",
+				"ALTER TABLE entries DROP COLUMN shadow_tls_password",
+				"ALTER TABLE entries DROP COLUMN obfs_host",
+				"ALTER TABLE entries DROP COLUMN obfs",
+			)
+		},
+	},
+	{
+		Version: 11,
+		Name:    "add_entries_timestamps",
+		Up: func(tx *sql.Tx, driver Driver) error {
+			timestamp := "TIMESTAMPTZ"
+			if driver == DriverSQLite {
+				timestamp = "TIMESTAMP"
+			}
+			if err := execAll(tx,
+				"ALTER TABLE entries ADD COLUMN created_at "+timestamp,
+				"ALTER TABLE entries ADD COLUMN updated_at "+timestamp,
+			); err != nil {
+				return err
+			}
+			// Existing entries were registered before the panel kept track
+			now := time.Now().UTC()
+			_, err := tx.Exec("UPDATE entries SET created_at = $1, updated_at = $1", now)
+			return err
+		},
+		Down: func(tx *sql.Tx, driver Driver) error {
+			return execAll(tx,
+				"ALTER TABLE entries DROP COLUMN updated_at",
+				"ALTER TABLE entries DROP COLUMN created_at",
+			)
+		},
+	},
+	{
+		Version: 12,
+		Name:    "create_tags",
+		Up: func(tx *sql.Tx, driver Driver) error {
+			primaryKey := "SERIAL PRIMARY KEY"
+			if driver == DriverSQLite {
+				primaryKey = "INTEGER PRIMARY KEY AUTOINCREMENT"
+			}
+			return execAll(tx,
+				`CREATE TABLE tags (
+					id `+primaryKey+`,
+					name TEXT NOT NULL UNIQUE
+				)`,
+				`CREATE TABLE entry_tags (
+					node_id TEXT NOT NULL REFERENCES entries (node_id) ON DELETE CASCADE,
+					tag_id INTEGER NOT NULL REFERENCES tags (id) ON DELETE CASCADE,
+					PRIMARY KEY (node_id, tag_id)
+				)`,
+				"CREATE INDEX entry_tags_tag_id ON entry_tags (tag_id)",
+			)
+		},
+		Down: func(tx *sql.Tx, driver Driver) error {
+			return execAll(tx,
+				"DROP TABLE entry_tags",
+				"DROP TABLE tags",
+			)
+		},
+	},
+	{
+		Version: 13,
+		Name:    "create_saved_subscriptions",
+		Up: func(tx *sql.Tx, driver Driver) error {
+			timestamp, primaryKey := "TIMESTAMPTZ", "SERIAL PRIMARY KEY"
+			if driver == DriverSQLite {
+				timestamp, primaryKey = "TIMESTAMP", "INTEGER PRIMARY KEY AUTOINCREMENT"
+			}
+			return execAll(tx, `
+				CREATE TABLE saved_subscriptions (
+					id `+primaryKey+`,
+					name TEXT NOT NULL,
+					slug TEXT NOT NULL UNIQUE,
+					format TEXT NOT NULL DEFAULT '',
+					filter TEXT NOT NULL DEFAULT '',
+					tags TEXT NOT NULL DEFAULT '',
+					exclude_tags TEXT NOT NULL DEFAULT '',
+					ip_version TEXT NOT NULL DEFAULT '',
+					healthy_only BOOLEAN,
+					show_flag BOOLEAN NOT NULL DEFAULT TRUE,
+					via TEXT NOT NULL DEFAULT '',
+					group_name TEXT NOT NULL DEFAULT '',
+					created_at `+timestamp+` NOT NULL,
+					updated_at `+timestamp+` NOT NULL
+				)`)
+		},
+		Down: func(tx *sql.Tx, driver Driver) error {
+			return execAll(tx, "DROP TABLE saved_subscriptions")
+		},
+	},
+	{
+		Version: 14,
+		Name:    "add_saved_subscriptions_rules",
+		Up: func(tx *sql.Tx, driver Driver) error {
+			return execAll(tx,
+				"ALTER TABLE saved_subscriptions ADD COLUMN include_pattern TEXT NOT NULL DEFAULT ''",
+				"ALTER TABLE saved_subscriptions ADD COLUMN exclude_pattern TEXT NOT NULL DEFAULT ''",
+				"ALTER TABLE saved_subscriptions ADD COLUMN rename_rules TEXT NOT NULL DEFAULT '[]'",
+			)
+		},
+		Down: func(tx *sql.Tx, driver Driver) error {
+			return execAll(tx,
+				"ALTER TABLE saved_subscriptions DROP COLUMN rename_rules",
+				"ALTER TABLE saved_subscriptions DROP COLUMN exclude_pattern",
+				"ALTER TABLE saved_subscriptions DROP COLUMN include_pattern",
+			)
+		},
+	},
+	{
+		Version: 15,
+		Name:    "add_saved_subscriptions_name_template",
+		Up: func(tx *sql.Tx, driver Driver) error {
+			return execAll(tx, "ALTER TABLE saved_subscriptions ADD COLUMN name_template TEXT NOT NULL DEFAULT ''")
+		},
+		Down: func(tx *sql.Tx, driver Driver) error {
+			return execAll(tx, "ALTER TABLE saved_subscriptions DROP COLUMN name_template")
+		},
+	},
+	{
+		Version: 16,
+		Name:    "add_entries_relay",
+		Up: func(tx *sql.Tx, driver Driver) error {
+			return execAll(tx,
+				"ALTER TABLE entries ADD COLUMN relay_node_id TEXT REFERENCES entries (node_id) ON DELETE SET NULL",
+				"ALTER TABLE entries ADD COLUMN relay_policy TEXT NOT NULL DEFAULT ''",
+			)
+		},
+		Down: func(tx *sql.Tx, driver Driver) error {
+			return execAll(tx,
+				"ALTER TABLE entries DROP COLUMN relay_policy",
+				"ALTER TABLE entries DROP COLUMN relay_node_id",
+			)
+		},
+	},
+	{
+		Version: 17,
+		Name:    "add_entries_address_unique",
+		Up: func(tx *sql.Tx, driver Driver) error {
+			if err := normalizeAddresses(tx); err != nil {
+				return err
+			}
+			return createAddressIndex(tx)
+		},
+		Down: func(tx *sql.Tx, driver Driver) error {
+			return execAll(tx, "DROP INDEX IF EXISTS entries_address")
+		},
+	},
+}
+
+// normalizeAddresses rewrites the ip of every entry in the form new
+// entries are stored in, so that lookups can compare it exactly
+func normalizeAddresses(tx *sql.Tx) error {
+	rows, err := tx.Query("SELECT id, ip FROM entries")
+	if err != nil {
+		return err
+	}
+
+	normalized := make(map[int]string)
+	for rows.Next() {
+		var id int
+		var addr string
+		if err := rows.Scan(&id, &addr); err != nil {
+			rows.Close()
+			return err
+		}
+		if normal := models.NormalizeAddress(addr); normal != addr {
+			normalized[id] = normal
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, addr := range normalized {
+		if _, err := tx.Exec("UPDATE entries SET ip = $1 WHERE id = $2", addr, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createAddressIndex adds the unique index on the address of entries.
+// Entries registered before addresses were validated may share one, in
+// which case they are logged and the index is left out until they are
+// deleted or modified; InitDB tries again at every start.
+func createAddressIndex(db execQuerier) error {
+	rows, err := db.Query(`
+		SELECT ip, port, COUNT(*) FROM entries
+		GROUP BY ip, port
+		HAVING COUNT(*) > 1
+		ORDER BY ip, port
+	`)
+	if err != nil {
+		return err
+	}
+	var duplicates []string
+	for rows.Next() {
+		var ip string
+		var port, count int
+		if err := rows.Scan(&ip, &port, &count); err != nil {
+			rows.Close()
+			return err
+		}
+		duplicates = append(duplicates, fmt.Sprintf("%s:%d (%d entries)", ip, port, count))
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if len(duplicates) > 0 {
+		log.Printf("Warning: several entries share %s, delete or modify all but one of each to enforce unique addresses",
+			strings.Join(duplicates, ", "))
+		return nil
+	}
+	_, err = db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS entries_address ON entries (ip, port)")
+	return err
+}
+
+// backfillAddresses copies the ip of entries registered with an IP
+// address into the column of its family. Domain entries are filled in by
+// the resolver worker.
+func backfillAddresses(tx *sql.Tx) error {
+	rows, err := tx.Query("SELECT id, ip FROM entries")
+	if err != nil {
+		return err
+	}
+
+	ipv4s := make(map[int]string)
+	ipv6s := make(map[int]string)
+	for rows.Next() {
+		var id int
+		var addr string
+		if err := rows.Scan(&id, &addr); err != nil {
+			rows.Close()
+			return err
+		}
+		if ip := net.ParseIP(addr); ip != nil {
+			if ip.To4() != nil {
+				ipv4s[id] = ip.String()
+			} else {
+				ipv6s[id] = ip.String()
+			}
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, addr := range ipv4s {
+		if _, err := tx.Exec("UPDATE entries SET ipv4 = $1 WHERE id = $2", addr, id); err != nil {
+			return err
+		}
+	}
+	for id, addr := range ipv6s {
+		if _, err := tx.Exec("UPDATE entries SET ipv6 = $1, ipv6_country_code = country_code, ipv6_isp = isp, ipv6_asn = asn WHERE id = $2", addr, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
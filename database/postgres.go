@@ -0,0 +1,46 @@
+/*
+ * @Author: Vincent Yang
+ * @Date: 2026-10-17 13:05:11
+ * @LastEditors: Vincent Yang
+ * @LastEditTime: 2026-10-17 15:02:44
+ * @FilePath: /snell-panel/database/postgres.go
+ * @Telegram: https://t.me/missuo
+ * @GitHub: https://github.com/missuo
+ *
+ * Copyright © 2026 by Vincent, All Rights Reserved.
+ */
+
+package database
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+// postgresUniqueViolation is the SQLSTATE of a unique constraint failure
+const postgresUniqueViolation = "23505"
+
+// openPostgres opens a PostgreSQL connection
+func openPostgres(dbURL string) (*sql.DB, error) {
+	db, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// Test the connection
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// isPostgresUniqueViolation reports whether an error is a PostgreSQL
+// unique constraint failure
+func isPostgresUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == postgresUniqueViolation
+}
@@ -0,0 +1,254 @@
+/*
+ * @Author: Vincent Yang
+ * @Date: 2026-10-17 22:21:09
+ * @LastEditors: Vincent Yang
+ * @LastEditTime: 2026-10-17 22:21:09
+ * @FilePath: /snell-panel/database/query.go
+ * @Telegram: https://t.me/missuo
+ * @GitHub: https://github.com/missuo
+ *
+ * Copyright © 2026 by Vincent, All Rights Reserved.
+ */
+
+package database
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"snell-panel/models"
+)
+
+// entrySortColumns maps the sortable fields to their SQL expression.
+// Entries that were never probed sort after every measured latency.
+var entrySortColumns = map[string]string{
+	models.SortID:      "e.id",
+	models.SortName:    "e.node_name",
+	models.SortCountry: "e.country_code",
+	models.SortLatency: "COALESCE(s.latency_ms, 2147483647)",
+}
+
+// IsValidEntrySort reports whether entries can be sorted by a field
+func IsValidEntrySort(sort string) bool {
+	_, ok := entrySortColumns[sort]
+	return ok
+}
+
+// entryCursor is the position after the last entry of a page. Value is
+// the sort field of that entry, ID breaks ties between equal values.
+type entryCursor struct {
+	Sort  string `json:"s"`
+	Desc  bool   `json:"d,omitempty"`
+	Value string `json:"v"`
+	ID    int    `json:"id"`
+}
+
+// encode returns the cursor as an opaque URL-safe string
+func (c entryCursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeEntryCursor parses a cursor created by encode
+func decodeEntryCursor(cursor string) (entryCursor, error) {
+	var c entryCursor
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err == nil {
+		err = json.Unmarshal(data, &c)
+	}
+	if err != nil {
+		return c, fmt.Errorf("%w: malformed cursor", models.ErrInvalidRequest)
+	}
+	return c, nil
+}
+
+// sortValue returns the value of the sort field of an entry, as stored
+// in a cursor
+func sortValue(entry models.Entry, sort string) string {
+	switch sort {
+	case models.SortName:
+		return entry.NodeName
+	case models.SortCountry:
+		return entry.CountryCode
+	case models.SortLatency:
+		if entry.LatencyMs == nil {
+			return "2147483647"
+		}
+		return strconv.Itoa(*entry.LatencyMs)
+	default:
+		return strconv.Itoa(entry.ID)
+	}
+}
+
+// cursorArg converts a cursor value back to the type of its sort field
+func cursorArg(sort, value string) (interface{}, error) {
+	if sort == models.SortName || sort == models.SortCountry {
+		return value, nil
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", models.ErrInvalidRequest)
+	}
+	return number, nil
+}
+
+// queryBuilder accumulates WHERE conditions and their numbered arguments
+type queryBuilder struct {
+	conditions []string
+	args       []interface{}
+}
+
+// arg adds an argument and returns its placeholder
+func (b *queryBuilder) arg(value interface{}) string {
+	b.args = append(b.args, value)
+	return "$" + strconv.Itoa(len(b.args))
+}
+
+// list adds every value as an argument and returns their placeholders
+// separated by commas, for use in an IN clause
+func (b *queryBuilder) list(values []string) string {
+	placeholders := make([]string, len(values))
+	for i, value := range values {
+		placeholders[i] = b.arg(value)
+	}
+	return strings.Join(placeholders, ", ")
+}
+
+// where adds a condition
+func (b *queryBuilder) where(condition string) {
+	b.conditions = append(b.conditions, condition)
+}
+
+// clause returns the WHERE clause of the conditions, if any
+func (b *queryBuilder) clause() string {
+	if len(b.conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(b.conditions, " AND ")
+}
+
+// filterEntries adds the filter conditions of a query
+func filterEntries(b *queryBuilder, query models.EntryQuery) {
+	if query.CountryCode != "" {
+		b.where("LOWER(e.country_code) = LOWER(" + b.arg(query.CountryCode) + ")")
+	}
+	if query.ASN != 0 {
+		b.where("e.asn = " + b.arg(query.ASN))
+	}
+	if query.ISP != "" {
+		b.where("LOWER(e.isp) LIKE " + b.arg("%"+strings.ToLower(query.ISP)+"%"))
+	}
+	if query.Version != "" {
+		b.where("e.version = " + b.arg(query.Version))
+	}
+	if query.Name != "" {
+		b.where("LOWER(e.node_name) LIKE " + b.arg("%"+strings.ToLower(query.Name)+"%"))
+	}
+	if query.Keyword != "" {
+		// SQLite's LIKE ignores case, REPLACE respects it on both backends
+		b.where("REPLACE(e.node_name, " + b.arg(query.Keyword) + ", '') <> e.node_name")
+	}
+	if query.Address != "" {
+		pattern := b.arg("%" + strings.ToLower(query.Address) + "%")
+		b.where("(LOWER(e.ip) LIKE " + pattern + " OR LOWER(e.ipv4) LIKE " + pattern + " OR LOWER(e.ipv6) LIKE " + pattern + ")")
+	}
+	for _, alternatives := range query.Tags {
+		b.where("EXISTS (" + taggedWith + b.list(alternatives) + "))")
+	}
+	if len(query.ExcludeTags) > 0 {
+		b.where("NOT EXISTS (" + taggedWith + b.list(query.ExcludeTags) + "))")
+	}
+}
+
+// taggedWith selects the tags of the current entry whose name is in the
+// list that follows
+const taggedWith = `SELECT 1 FROM entry_tags et JOIN tags t ON t.id = et.tag_id
+	WHERE et.node_id = e.node_id AND t.name IN (`
+
+// QueryEntries returns a page of the entries matching a query, with the
+// total number of matches
+func (r *sqlRepository) QueryEntries(query models.EntryQuery) (*models.EntryPage, error) {
+	sort := query.Sort
+	if sort == "" {
+		sort = models.SortID
+	}
+	column, ok := entrySortColumns[sort]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown sort field %q", models.ErrInvalidRequest, sort)
+	}
+
+	var filters queryBuilder
+	filterEntries(&filters, query)
+
+	var total int
+	countQuery := "SELECT COUNT(*) FROM entries e LEFT JOIN node_status s ON s.node_id = e.node_id" + filters.clause()
+	if err := r.db.QueryRow(countQuery, filters.args...).Scan(&total); err != nil {
+		return nil, err
+	}
+
+	page := filters
+	if query.Cursor != "" {
+		cursor, err := decodeEntryCursor(query.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if cursor.Sort != sort || cursor.Desc != query.Desc {
+			return nil, fmt.Errorf("%w: cursor was created with a different sort", models.ErrInvalidRequest)
+		}
+		value, err := cursorArg(sort, cursor.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		operator := ">"
+		if query.Desc {
+			operator = "<"
+		}
+		if sort == models.SortID {
+			page.where(fmt.Sprintf("e.id %s %s", operator, page.arg(cursor.ID)))
+		} else {
+			v := page.arg(value)
+			page.where(fmt.Sprintf("(%s %s %s OR (%s = %s AND e.id %s %s))",
+				column, operator, v, column, v, operator, page.arg(cursor.ID)))
+		}
+	}
+
+	direction := "ASC"
+	if query.Desc {
+		direction = "DESC"
+	}
+	sql := entrySelect + page.clause()
+	if sort == models.SortID {
+		sql += " ORDER BY e.id " + direction
+	} else {
+		sql += fmt.Sprintf(" ORDER BY %s %s, e.id %s", column, direction, direction)
+	}
+	if query.Limit > 0 {
+		// Fetch one extra entry to know whether there is a next page
+		sql += " LIMIT " + page.arg(query.Limit+1)
+	}
+
+	entries, err := r.queryEntries(sql, page.args...)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.EntryPage{
+		Entries: entries,
+		Meta:    models.PageMeta{Total: total, Limit: query.Limit},
+	}
+	if query.Limit > 0 && len(entries) > query.Limit {
+		result.Entries = entries[:query.Limit]
+		last := result.Entries[query.Limit-1]
+		result.Meta.NextCursor = entryCursor{
+			Sort:  sort,
+			Desc:  query.Desc,
+			Value: sortValue(last, sort),
+			ID:    last.ID,
+		}.encode()
+	}
+	return result, nil
+}
@@ -0,0 +1,378 @@
+/*
+ * @Author: Vincent Yang
+ * @Date: 2026-10-17 13:31:26
+ * @LastEditors: Vincent Yang
+ * @LastEditTime: 2026-10-17 13:31:26
+ * @FilePath: /snell-panel/database/repository.go
+ * @Telegram: https://t.me/missuo
+ * @GitHub: https://github.com/missuo
+ *
+ * Copyright © 2026 by Vincent, All Rights Reserved.
+ */
+
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"snell-panel/models"
+)
+
+// EntryRepository defines the storage operations for entries
+type EntryRepository interface {
+	// Create inserts a new entry with its tags and sets its ID
+	Create(entry *models.Entry) error
+	// List returns every entry ordered by ID
+	List() ([]models.Entry, error)
+	// QueryEntries returns a page of the entries matching a query, with
+	// the total number of matches
+	QueryEntries(query models.EntryQuery) (*models.EntryPage, error)
+	// GetByNodeID returns the entry with the given node ID
+	GetByNodeID(nodeID string) (*models.Entry, error)
+	// Update saves the given fields of an entry, matched by node ID, in a
+	// single statement that keeps the other fields as they are stored.
+	// Fields are named like in JSON.
+	Update(entry *models.Entry, fields []string) error
+	// AddressInUse reports whether another entry than excludeNodeID
+	// already uses the given address and port. Addresses are compared in
+	// the form of models.NormalizeAddress.
+	AddressInUse(ip string, port int, excludeNodeID string) (bool, error)
+	// DeleteByIP deletes all entries with the given IP or domain
+	DeleteByIP(ip string) error
+	// DeleteByNodeID deletes the entry with the given node ID
+	DeleteByNodeID(nodeID string) error
+}
+
+// Repository groups every storage interface backed by one database
+type Repository interface {
+	EntryRepository
+	TokenRepository
+	StatusRepository
+	GeoRepository
+	ResolutionRepository
+	TagRepository
+	SubscriptionRepository
+	// Close closes the underlying database connection
+	Close() error
+}
+
+// entrySelect selects entries joined with their health status, in the
+// column order scanEntry expects
+const entrySelect = `
+	SELECT e.id, e.ip, e.ipv4, e.ipv6, e.port, e.psk, e.country_code, e.isp, e.asn, e.node_id, e.node_name, e.version,
+		e.ipv6_country_code, e.ipv6_isp, e.ipv6_asn,
+		e.obfs, e.obfs_host, e.shadow_tls_password, e.shadow_tls_sni, e.shadow_tls_version, e.shadow_tls_port, e.tfo, e.reuse,
+		e.relay_node_id, e.relay_policy,
+		e.geo_status, e.geo_error, e.geo_attempts, e.geo_retry_at,
+		e.resolved_ips, e.resolved_at, e.resolve_error, e.unresolvable_since,
+		e.created_at, e.updated_at,
+		s.status, s.latency_ms, s.last_seen, s.failing_since, s.last_error
+	FROM entries e
+	LEFT JOIN node_status s ON s.node_id = e.node_id`
+
+// sqlRepository implements Repository on top of database/sql.
+// The queries only use syntax shared by PostgreSQL and SQLite.
+type sqlRepository struct {
+	db *sql.DB
+}
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanEntry scans a row selected with entrySelect into an entry
+func scanEntry(row rowScanner) (models.Entry, error) {
+	var entry models.Entry
+	var status sql.NullString
+	var latencyMs sql.NullInt64
+	var lastSeen, failingSince, geoRetryAt, resolvedAt, unresolvableSince sql.NullTime
+	var createdAt, updatedAt sql.NullTime
+	var lastError sql.NullString
+	var resolvedIPs string
+	var relayNodeID sql.NullString
+	err := row.Scan(
+		&entry.ID, &entry.IP, &entry.IPv4, &entry.IPv6, &entry.Port, &entry.PSK,
+		&entry.CountryCode, &entry.ISP, &entry.ASN,
+		&entry.NodeID, &entry.NodeName, &entry.Version,
+		&entry.IPv6CountryCode, &entry.IPv6ISP, &entry.IPv6ASN,
+		&entry.Obfs, &entry.ObfsHost, &entry.ShadowTLSPassword, &entry.ShadowTLSSNI, &entry.ShadowTLSVersion, &entry.ShadowTLSPort, &entry.TFO, &entry.Reuse,
+		&relayNodeID, &entry.RelayPolicy,
+		&entry.GeoStatus, &entry.GeoError, &entry.GeoAttempts, &geoRetryAt,
+		&resolvedIPs, &resolvedAt, &entry.ResolveError, &unresolvableSince,
+		&createdAt, &updatedAt,
+		&status, &latencyMs, &lastSeen, &failingSince, &lastError,
+	)
+	if err != nil {
+		return entry, err
+	}
+
+	entry.Status = models.NodeStatusUnknown
+	if status.Valid {
+		entry.Status = status.String
+	}
+	if latencyMs.Valid {
+		latency := int(latencyMs.Int64)
+		entry.LatencyMs = &latency
+	}
+	if lastSeen.Valid {
+		entry.LastSeen = &lastSeen.Time
+	}
+	if failingSince.Valid {
+		entry.FailingSince = &failingSince.Time
+	}
+	entry.LastError = lastError.String
+	entry.RelayNodeID = relayNodeID.String
+	if geoRetryAt.Valid {
+		entry.GeoRetryAt = &geoRetryAt.Time
+	}
+	entry.ResolvedIPs = splitList(resolvedIPs)
+	if resolvedAt.Valid {
+		entry.ResolvedAt = &resolvedAt.Time
+	}
+	if unresolvableSince.Valid {
+		entry.UnresolvableSince = &unresolvableSince.Time
+	}
+	entry.CreatedAt = createdAt.Time
+	entry.UpdatedAt = updatedAt.Time
+	return entry, nil
+}
+
+// splitList splits a comma-joined column, returning nil for an empty one
+func splitList(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+// nullString stores an empty string as NULL, for nullable foreign keys
+func nullString(value string) sql.NullString {
+	return sql.NullString{String: value, Valid: value != ""}
+}
+
+// queryEntries runs a query built on entrySelect and collects the rows
+// with their tags
+func (r *sqlRepository) queryEntries(query string, args ...interface{}) ([]models.Entry, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []models.Entry
+	for rows.Next() {
+		entry, err := scanEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	if err := r.attachTags(entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// checkAffected returns models.ErrNotFound when a statement changed no rows
+func checkAffected(result sql.Result) error {
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return models.ErrNotFound
+	}
+	return nil
+}
+
+// addressConflict reports a write that broke the address uniqueness of
+// entries as models.ErrConflict. The service checks AddressInUse first,
+// this covers concurrent writes of the same address.
+func addressConflict(entry *models.Entry, err error) error {
+	if isUniqueViolation(err) {
+		return fmt.Errorf("%w: %s:%d is already used by another node", models.ErrConflict, entry.IP, entry.Port)
+	}
+	return err
+}
+
+// Create inserts a new entry with its tags in one transaction and sets its ID
+func (r *sqlRepository) Create(entry *models.Entry) error {
+	entry.CreatedAt = time.Now().UTC()
+	entry.UpdatedAt = entry.CreatedAt
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(`
+		 INSERT INTO entries (ip, port, psk, country_code, isp, asn, node_id, node_name, version,
+			geo_status, geo_error, geo_attempts, geo_retry_at,
+			ipv4, ipv6, ipv6_country_code, ipv6_isp, ipv6_asn,
+			obfs, obfs_host, shadow_tls_password, shadow_tls_sni, shadow_tls_version, shadow_tls_port, tfo, reuse,
+			created_at, updated_at, relay_node_id, relay_policy)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18,
+			$19, $20, $21, $22, $23, $24, $25, $26, $27, $28, $29, $30)
+		 RETURNING id`,
+		entry.IP, entry.Port, entry.PSK, entry.CountryCode, entry.ISP, entry.ASN, entry.NodeID, entry.NodeName, entry.Version,
+		entry.GeoStatus, entry.GeoError, entry.GeoAttempts, entry.GeoRetryAt,
+		entry.IPv4, entry.IPv6, entry.IPv6CountryCode, entry.IPv6ISP, entry.IPv6ASN,
+		entry.Obfs, entry.ObfsHost, entry.ShadowTLSPassword, entry.ShadowTLSSNI, entry.ShadowTLSVersion, entry.ShadowTLSPort, entry.TFO, entry.Reuse,
+		entry.CreatedAt, entry.UpdatedAt, nullString(entry.RelayNodeID), entry.RelayPolicy).Scan(&entry.ID)
+	if err != nil {
+		return addressConflict(entry, err)
+	}
+	if err := insertTags(tx, []string{entry.NodeID}, entry.Tags); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// List returns every entry ordered by ID
+func (r *sqlRepository) List() ([]models.Entry, error) {
+	return r.queryEntries(entrySelect + " ORDER BY e.id")
+}
+
+// GetByNodeID returns the entry with the given node ID
+func (r *sqlRepository) GetByNodeID(nodeID string) (*models.Entry, error) {
+	row := r.db.QueryRow(entrySelect+" WHERE e.node_id = $1", nodeID)
+	entry, err := scanEntry(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []models.Entry{entry}
+	if err := r.attachTags(entries); err != nil {
+		return nil, err
+	}
+	return &entries[0], nil
+}
+
+// Update saves the given fields of an entry, matched by node ID. Changing
+// any address also saves the geolocation and resolution state derived
+// from the addresses.
+func (r *sqlRepository) Update(entry *models.Entry, fields []string) error {
+	entry.UpdatedAt = time.Now().UTC()
+
+	var assignments []string
+	var args []interface{}
+	written := make(map[string]bool)
+	for _, field := range fields {
+		columns, values, err := entryColumns(entry, field)
+		if err != nil {
+			return err
+		}
+		for i, column := range columns {
+			if written[column] {
+				continue
+			}
+			written[column] = true
+			args = append(args, values[i])
+			assignments = append(assignments, fmt.Sprintf("%s = $%d", column, len(args)))
+		}
+	}
+	args = append(args, entry.UpdatedAt, entry.NodeID)
+	assignments = append(assignments, fmt.Sprintf("updated_at = $%d", len(args)-1))
+
+	result, err := r.db.Exec(
+		"UPDATE entries SET "+strings.Join(assignments, ", ")+fmt.Sprintf(" WHERE node_id = $%d", len(args)),
+		args...)
+	if err != nil {
+		return addressConflict(entry, err)
+	}
+	return checkAffected(result)
+}
+
+// entryColumns returns the columns that store a field of an entry, named
+// like in JSON, and their values
+func entryColumns(entry *models.Entry, field string) ([]string, []interface{}, error) {
+	switch field {
+	case "ip", "ipv4", "ipv6":
+		return []string{
+			"ip", "ipv4", "ipv6", "country_code", "isp", "asn", "ipv6_country_code", "ipv6_isp", "ipv6_asn",
+			"geo_status", "geo_error", "geo_attempts", "geo_retry_at",
+			"resolved_ips", "resolved_at", "resolve_error", "unresolvable_since",
+		}, []interface{}{
+			entry.IP, entry.IPv4, entry.IPv6, entry.CountryCode, entry.ISP, entry.ASN, entry.IPv6CountryCode, entry.IPv6ISP, entry.IPv6ASN,
+			entry.GeoStatus, entry.GeoError, entry.GeoAttempts, entry.GeoRetryAt,
+			strings.Join(entry.ResolvedIPs, ","), entry.ResolvedAt, entry.ResolveError, entry.UnresolvableSince,
+		}, nil
+	case "port":
+		return []string{"port"}, []interface{}{entry.Port}, nil
+	case "psk":
+		return []string{"psk"}, []interface{}{entry.PSK}, nil
+	case "node_name":
+		return []string{"node_name"}, []interface{}{entry.NodeName}, nil
+	case "version":
+		return []string{"version"}, []interface{}{entry.Version}, nil
+	case "obfs":
+		return []string{"obfs"}, []interface{}{entry.Obfs}, nil
+	case "obfs_host":
+		return []string{"obfs_host"}, []interface{}{entry.ObfsHost}, nil
+	case "shadow_tls_password":
+		return []string{"shadow_tls_password"}, []interface{}{entry.ShadowTLSPassword}, nil
+	case "shadow_tls_sni":
+		return []string{"shadow_tls_sni"}, []interface{}{entry.ShadowTLSSNI}, nil
+	case "shadow_tls_version":
+		return []string{"shadow_tls_version"}, []interface{}{entry.ShadowTLSVersion}, nil
+	case "shadow_tls_port":
+		return []string{"shadow_tls_port"}, []interface{}{entry.ShadowTLSPort}, nil
+	case "tfo":
+		return []string{"tfo"}, []interface{}{entry.TFO}, nil
+	case "reuse":
+		return []string{"reuse"}, []interface{}{entry.Reuse}, nil
+	case "relay_node_id":
+		return []string{"relay_node_id"}, []interface{}{nullString(entry.RelayNodeID)}, nil
+	case "relay_policy":
+		return []string{"relay_policy"}, []interface{}{entry.RelayPolicy}, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown entry field %q", field)
+	}
+}
+
+// AddressInUse reports whether another entry already uses an address and port
+func (r *sqlRepository) AddressInUse(ip string, port int, excludeNodeID string) (bool, error) {
+	var count int
+	err := r.db.QueryRow(`
+		 SELECT COUNT(*) FROM entries
+		 WHERE ip = $1 AND port = $2 AND node_id <> $3`,
+		ip, port, excludeNodeID).Scan(&count)
+	return count > 0, err
+}
+
+// DeleteByIP deletes all entries with the given IP or domain
+func (r *sqlRepository) DeleteByIP(ip string) error {
+	result, err := r.db.Exec("DELETE FROM entries WHERE ip = $1", ip)
+	if err != nil {
+		return err
+	}
+	return checkAffected(result)
+}
+
+// DeleteByNodeID deletes the entry with the given node ID
+func (r *sqlRepository) DeleteByNodeID(nodeID string) error {
+	result, err := r.db.Exec("DELETE FROM entries WHERE node_id = $1", nodeID)
+	if err != nil {
+		return err
+	}
+	return checkAffected(result)
+}
+
+// Close closes the underlying database connection
+func (r *sqlRepository) Close() error {
+	return r.db.Close()
+}
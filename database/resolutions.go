@@ -0,0 +1,115 @@
+/*
+ * @Author: Vincent Yang
+ * @Date: 2026-10-17 20:06:19
+ * @LastEditors: Vincent Yang
+ * @LastEditTime: 2026-10-17 20:06:19
+ * @FilePath: /snell-panel/database/resolutions.go
+ * @Telegram: https://t.me/missuo
+ * @GitHub: https://github.com/missuo
+ *
+ * Copyright © 2026 by Vincent, All Rights Reserved.
+ */
+
+package database
+
+import (
+	"strings"
+
+	"snell-panel/models"
+)
+
+// resolutionHistoryLimit caps how many resolution changes are kept per node
+const resolutionHistoryLimit = 50
+
+// ResolutionRepository defines the storage operations for domain resolution
+type ResolutionRepository interface {
+	// SaveResolution saves the resolution, address and geolocation fields of an
+	// entry, matched by node ID and address, and appends the record to its
+	// history when not nil. It returns models.ErrNotFound when the entry
+	// was deleted or its address changed.
+	SaveResolution(entry *models.Entry, record *models.Resolution) error
+	// ListResolutions returns the resolution history of a node, newest first
+	ListResolutions(nodeID string) ([]models.Resolution, error)
+}
+
+// SaveResolution saves the resolution state of an entry and its history
+func (r *sqlRepository) SaveResolution(entry *models.Entry, record *models.Resolution) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		 UPDATE entries
+		 SET resolved_ips = $1, resolved_at = $2, resolve_error = $3, unresolvable_since = $4,
+			country_code = $5, isp = $6, asn = $7,
+			geo_status = $8, geo_error = $9, geo_attempts = $10, geo_retry_at = $11,
+			ipv4 = $12, ipv6 = $13, ipv6_country_code = $14, ipv6_isp = $15, ipv6_asn = $16
+		 WHERE node_id = $17 AND ip = $18`,
+		strings.Join(entry.ResolvedIPs, ","), entry.ResolvedAt, entry.ResolveError, entry.UnresolvableSince,
+		entry.CountryCode, entry.ISP, entry.ASN,
+		entry.GeoStatus, entry.GeoError, entry.GeoAttempts, entry.GeoRetryAt,
+		entry.IPv4, entry.IPv6, entry.IPv6CountryCode, entry.IPv6ISP, entry.IPv6ASN,
+		entry.NodeID, entry.IP)
+	if err != nil {
+		return err
+	}
+	if err := checkAffected(result); err != nil {
+		return err
+	}
+
+	if record != nil {
+		err = tx.QueryRow(`
+			 INSERT INTO entry_resolutions (node_id, domain, addresses, error, resolved_at)
+			 VALUES ($1, $2, $3, $4, $5)
+			 RETURNING id`,
+			record.NodeID, record.Domain, strings.Join(record.Addresses, ","), record.Error, record.ResolvedAt).Scan(&record.ID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`
+			 DELETE FROM entry_resolutions
+			 WHERE node_id = $1 AND id NOT IN (
+				SELECT id FROM entry_resolutions WHERE node_id = $1 ORDER BY id DESC LIMIT $2
+			 )`,
+			record.NodeID, resolutionHistoryLimit)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ListResolutions returns the resolution history of a node, newest first
+func (r *sqlRepository) ListResolutions(nodeID string) ([]models.Resolution, error) {
+	rows, err := r.db.Query(`
+		 SELECT id, node_id, domain, addresses, error, resolved_at
+		 FROM entry_resolutions
+		 WHERE node_id = $1
+		 ORDER BY id DESC`,
+		nodeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	resolutions := []models.Resolution{}
+	for rows.Next() {
+		var resolution models.Resolution
+		var addresses string
+		err := rows.Scan(&resolution.ID, &resolution.NodeID, &resolution.Domain, &addresses, &resolution.Error, &resolution.ResolvedAt)
+		if err != nil {
+			return nil, err
+		}
+		resolution.Addresses = splitList(addresses)
+		if resolution.Addresses == nil {
+			resolution.Addresses = []string{}
+		}
+		resolutions = append(resolutions, resolution)
+	}
+
+	return resolutions, rows.Err()
+}
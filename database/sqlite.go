@@ -0,0 +1,73 @@
+/*
+ * @Author: Vincent Yang
+ * @Date: 2026-10-17 13:18:47
+ * @LastEditors: Vincent Yang
+ * @LastEditTime: 2026-10-17 15:02:44
+ * @FilePath: /snell-panel/database/sqlite.go
+ * @Telegram: https://t.me/missuo
+ * @GitHub: https://github.com/missuo
+ *
+ * Copyright © 2026 by Vincent, All Rights Reserved.
+ */
+
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// sqlitePragmas are applied to every SQLite connection
+var sqlitePragmas = []string{
+	"_pragma=foreign_keys(1)",
+	"_pragma=busy_timeout(5000)",
+	"_pragma=journal_mode(WAL)",
+}
+
+// openSQLite opens an embedded SQLite database
+func openSQLite(dsn string) (*sql.DB, error) {
+	if !strings.HasPrefix(dsn, "file:") {
+		// Make sure the directory holding the database file exists
+		if dir := filepath.Dir(dsn); dir != "." {
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				return nil, fmt.Errorf("failed to create database directory: %w", err)
+			}
+		}
+		dsn = "file:" + dsn
+	}
+
+	separator := "?"
+	if strings.Contains(dsn, "?") {
+		separator = "&"
+	}
+	dsn += separator + strings.Join(sqlitePragmas, "&")
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite allows a single writer, serialize access through one connection
+	db.SetMaxOpenConns(1)
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// isSQLiteUniqueViolation reports whether an error is a SQLite unique
+// constraint failure
+func isSQLiteUniqueViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+}
@@ -0,0 +1,51 @@
+/*
+ * @Author: Vincent Yang
+ * @Date: 2026-10-17 17:20:38
+ * @LastEditors: Vincent Yang
+ * @LastEditTime: 2026-10-17 17:20:38
+ * @FilePath: /snell-panel/database/status.go
+ * @Telegram: https://t.me/missuo
+ * @GitHub: https://github.com/missuo
+ *
+ * Copyright © 2026 by Vincent, All Rights Reserved.
+ */
+
+package database
+
+import (
+	"time"
+
+	"snell-panel/models"
+)
+
+// StatusRepository defines the storage operations for node health
+type StatusRepository interface {
+	// SaveNodeStatus records the result of a health probe. A nil LastSeen
+	// keeps the previously recorded value, and FailingSince is kept from
+	// the first of consecutive failed probes.
+	SaveNodeStatus(status *models.NodeStatus) error
+}
+
+// SaveNodeStatus records the result of a health probe
+func (r *sqlRepository) SaveNodeStatus(status *models.NodeStatus) error {
+	var failingSince *time.Time
+	if status.Status == models.NodeStatusDown {
+		failingSince = &status.LastChecked
+	}
+
+	_, err := r.db.Exec(`
+		 INSERT INTO node_status (node_id, status, latency_ms, last_seen, last_checked, last_error, failing_since)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)
+		 ON CONFLICT (node_id) DO UPDATE SET
+			status = excluded.status,
+			latency_ms = excluded.latency_ms,
+			last_seen = COALESCE(excluded.last_seen, node_status.last_seen),
+			last_checked = excluded.last_checked,
+			last_error = excluded.last_error,
+			failing_since = CASE
+				WHEN excluded.failing_since IS NULL THEN NULL
+				ELSE COALESCE(node_status.failing_since, excluded.failing_since)
+			END`,
+		status.NodeID, status.Status, status.LatencyMs, status.LastSeen, status.LastChecked, status.LastError, failingSince)
+	return err
+}
@@ -0,0 +1,178 @@
+/*
+ * @Author: Vincent Yang
+ * @Date: 2026-10-18 00:34:27
+ * @LastEditors: Vincent Yang
+ * @LastEditTime: 2026-10-18 00:34:27
+ * @FilePath: /snell-panel/database/subscriptions.go
+ * @Telegram: https://t.me/missuo
+ * @GitHub: https://github.com/missuo
+ *
+ * Copyright © 2026 by Vincent, All Rights Reserved.
+ */
+
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"snell-panel/models"
+)
+
+// SubscriptionRepository defines the storage operations for saved subscriptions
+type SubscriptionRepository interface {
+	// CreateSubscription inserts a new saved subscription and sets its ID
+	// and timestamps
+	CreateSubscription(sub *models.SavedSubscription) error
+	// ListSubscriptions returns every saved subscription ordered by ID
+	ListSubscriptions() ([]models.SavedSubscription, error)
+	// GetSubscription returns the saved subscription with the given ID
+	GetSubscription(id int) (*models.SavedSubscription, error)
+	// GetSubscriptionBySlug returns the saved subscription with the given slug
+	GetSubscriptionBySlug(slug string) (*models.SavedSubscription, error)
+	// UpdateSubscription saves every field of a saved subscription, including its slug
+	UpdateSubscription(sub *models.SavedSubscription) error
+	// DeleteSubscription deletes the saved subscription with the given ID
+	DeleteSubscription(id int) error
+}
+
+// subscriptionColumns lists the saved_subscriptions columns in the order
+// scanSubscription expects
+const subscriptionColumns = `id, name, slug, format, filter, tags, exclude_tags, ip_version, healthy_only,
+	include_pattern, exclude_pattern, rename_rules, show_flag, name_template, via, group_name, created_at, updated_at`
+
+// scanSubscription scans a row selected with subscriptionColumns
+func scanSubscription(row rowScanner) (models.SavedSubscription, error) {
+	var sub models.SavedSubscription
+	var healthyOnly sql.NullBool
+	var renameRules string
+	err := row.Scan(&sub.ID, &sub.Name, &sub.Slug, &sub.Format, &sub.Filter, &sub.Tags, &sub.ExcludeTags,
+		&sub.IPVersion, &healthyOnly, &sub.Include, &sub.Exclude, &renameRules,
+		&sub.ShowFlag, &sub.NameTemplate, &sub.Via, &sub.Group, &sub.CreatedAt, &sub.UpdatedAt)
+	if err != nil {
+		return sub, err
+	}
+	if err := json.Unmarshal([]byte(renameRules), &sub.Rename); err != nil {
+		return sub, err
+	}
+	if healthyOnly.Valid {
+		sub.HealthyOnly = &healthyOnly.Bool
+	}
+	return sub, nil
+}
+
+// CreateSubscription inserts a new saved subscription
+func (r *sqlRepository) CreateSubscription(sub *models.SavedSubscription) error {
+	renameRules, err := encodeRenameRules(sub.Rename)
+	if err != nil {
+		return err
+	}
+
+	sub.CreatedAt = time.Now().UTC()
+	sub.UpdatedAt = sub.CreatedAt
+	return r.db.QueryRow(`
+		 INSERT INTO saved_subscriptions (name, slug, format, filter, tags, exclude_tags, ip_version, healthy_only,
+			include_pattern, exclude_pattern, rename_rules, show_flag, name_template, via, group_name, created_at, updated_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
+		 RETURNING id`,
+		sub.Name, sub.Slug, sub.Format, sub.Filter, sub.Tags, sub.ExcludeTags, sub.IPVersion, sub.HealthyOnly,
+		sub.Include, sub.Exclude, renameRules, sub.ShowFlag, sub.NameTemplate, sub.Via, sub.Group,
+		sub.CreatedAt, sub.UpdatedAt).Scan(&sub.ID)
+}
+
+// encodeRenameRules encodes rename rules as the JSON array stored in
+// the rename_rules column
+func encodeRenameRules(rules []models.RenameRule) (string, error) {
+	if rules == nil {
+		rules = []models.RenameRule{}
+	}
+	data, err := json.Marshal(rules)
+	return string(data), err
+}
+
+// ListSubscriptions returns every saved subscription ordered by ID
+func (r *sqlRepository) ListSubscriptions() ([]models.SavedSubscription, error) {
+	rows, err := r.db.Query("SELECT " + subscriptionColumns + " FROM saved_subscriptions ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subs []models.SavedSubscription
+	for rows.Next() {
+		sub, err := scanSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+	return subs, rows.Err()
+}
+
+// getSubscriptionWhere returns the saved subscription matching a condition
+func (r *sqlRepository) getSubscriptionWhere(condition string, arg interface{}) (*models.SavedSubscription, error) {
+	row := r.db.QueryRow("SELECT "+subscriptionColumns+" FROM saved_subscriptions WHERE "+condition, arg)
+	sub, err := scanSubscription(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, models.ErrSubscriptionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+// GetSubscription returns the saved subscription with the given ID
+func (r *sqlRepository) GetSubscription(id int) (*models.SavedSubscription, error) {
+	return r.getSubscriptionWhere("id = $1", id)
+}
+
+// GetSubscriptionBySlug returns the saved subscription with the given slug
+func (r *sqlRepository) GetSubscriptionBySlug(slug string) (*models.SavedSubscription, error) {
+	return r.getSubscriptionWhere("slug = $1", slug)
+}
+
+// UpdateSubscription saves every field of a saved subscription
+func (r *sqlRepository) UpdateSubscription(sub *models.SavedSubscription) error {
+	renameRules, err := encodeRenameRules(sub.Rename)
+	if err != nil {
+		return err
+	}
+
+	sub.UpdatedAt = time.Now().UTC()
+	result, err := r.db.Exec(`
+		 UPDATE saved_subscriptions
+		 SET name = $1, slug = $2, format = $3, filter = $4, tags = $5, exclude_tags = $6, ip_version = $7,
+			healthy_only = $8, include_pattern = $9, exclude_pattern = $10, rename_rules = $11,
+			show_flag = $12, name_template = $13, via = $14, group_name = $15, updated_at = $16
+		 WHERE id = $17`,
+		sub.Name, sub.Slug, sub.Format, sub.Filter, sub.Tags, sub.ExcludeTags, sub.IPVersion,
+		sub.HealthyOnly, sub.Include, sub.Exclude, renameRules,
+		sub.ShowFlag, sub.NameTemplate, sub.Via, sub.Group, sub.UpdatedAt,
+		sub.ID)
+	if err != nil {
+		return err
+	}
+	return subscriptionAffected(result)
+}
+
+// DeleteSubscription deletes the saved subscription with the given ID
+func (r *sqlRepository) DeleteSubscription(id int) error {
+	result, err := r.db.Exec("DELETE FROM saved_subscriptions WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	return subscriptionAffected(result)
+}
+
+// subscriptionAffected returns models.ErrSubscriptionNotFound when a
+// statement changed no saved subscription
+func subscriptionAffected(result sql.Result) error {
+	err := checkAffected(result)
+	if errors.Is(err, models.ErrNotFound) {
+		return models.ErrSubscriptionNotFound
+	}
+	return err
+}
@@ -0,0 +1,174 @@
+/*
+ * @Author: Vincent Yang
+ * @Date: 2026-10-17 23:31:52
+ * @LastEditors: Vincent Yang
+ * @LastEditTime: 2026-10-17 23:31:52
+ * @FilePath: /snell-panel/database/tags.go
+ * @Telegram: https://t.me/missuo
+ * @GitHub: https://github.com/missuo
+ *
+ * Copyright © 2026 by Vincent, All Rights Reserved.
+ */
+
+package database
+
+import (
+	"database/sql"
+
+	"snell-panel/models"
+)
+
+// TagRepository defines the storage operations for node tags
+type TagRepository interface {
+	// ListTags returns every tag carried by at least one node, by name
+	ListTags() ([]models.Tag, error)
+	// TagEntries adds tags to nodes, creating the tags that do not exist
+	// yet. It returns models.ErrNotFound without tagging anything when a
+	// node does not exist.
+	TagEntries(nodeIDs, tags []string) error
+	// UntagEntries removes tags from nodes. It returns models.ErrNotFound
+	// without untagging anything when a node does not exist.
+	UntagEntries(nodeIDs, tags []string) error
+}
+
+// ListTags returns every tag carried by at least one node, by name
+func (r *sqlRepository) ListTags() ([]models.Tag, error) {
+	rows, err := r.db.Query(`
+		 SELECT t.name, COUNT(*)
+		 FROM tags t
+		 JOIN entry_tags et ON et.tag_id = t.id
+		 GROUP BY t.name
+		 ORDER BY t.name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []models.Tag
+	for rows.Next() {
+		var tag models.Tag
+		if err := rows.Scan(&tag.Name, &tag.Count); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+// checkEntriesExist returns models.ErrNotFound unless every node exists
+func checkEntriesExist(tx *sql.Tx, nodeIDs []string) error {
+	var b queryBuilder
+	var count int
+	err := tx.QueryRow("SELECT COUNT(*) FROM entries WHERE node_id IN ("+b.list(nodeIDs)+")", b.args...).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count != len(nodeIDs) {
+		return models.ErrNotFound
+	}
+	return nil
+}
+
+// TagEntries adds tags to nodes, creating the missing tags
+func (r *sqlRepository) TagEntries(nodeIDs, tags []string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := checkEntriesExist(tx, nodeIDs); err != nil {
+		return err
+	}
+	if err := insertTags(tx, nodeIDs, tags); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// insertTags adds tags to existing nodes within a transaction, creating
+// the missing tags
+func insertTags(tx *sql.Tx, nodeIDs, tags []string) error {
+	for _, tag := range tags {
+		if _, err := tx.Exec("INSERT INTO tags (name) VALUES ($1) ON CONFLICT (name) DO NOTHING", tag); err != nil {
+			return err
+		}
+		for _, nodeID := range nodeIDs {
+			_, err := tx.Exec(`
+				 INSERT INTO entry_tags (node_id, tag_id)
+				 SELECT $1, id FROM tags WHERE name = $2
+				 ON CONFLICT (node_id, tag_id) DO NOTHING`,
+				nodeID, tag)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// UntagEntries removes tags from nodes
+func (r *sqlRepository) UntagEntries(nodeIDs, tags []string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := checkEntriesExist(tx, nodeIDs); err != nil {
+		return err
+	}
+
+	var b queryBuilder
+	nodes := b.list(nodeIDs)
+	names := b.list(tags)
+	_, err = tx.Exec(`
+		 DELETE FROM entry_tags
+		 WHERE node_id IN (`+nodes+`)
+			AND tag_id IN (SELECT id FROM tags WHERE name IN (`+names+`))`,
+		b.args...)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// attachTags loads the tags of entries, sorted by name. Entries without
+// tags get an empty list.
+func (r *sqlRepository) attachTags(entries []models.Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	nodeIDs := make([]string, len(entries))
+	index := make(map[string]int, len(entries))
+	for i := range entries {
+		nodeIDs[i] = entries[i].NodeID
+		index[entries[i].NodeID] = i
+		entries[i].Tags = []string{}
+	}
+
+	var b queryBuilder
+	rows, err := r.db.Query(`
+		 SELECT et.node_id, t.name
+		 FROM entry_tags et
+		 JOIN tags t ON t.id = et.tag_id
+		 WHERE et.node_id IN (`+b.list(nodeIDs)+`)
+		 ORDER BY t.name`,
+		b.args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var nodeID, name string
+		if err := rows.Scan(&nodeID, &name); err != nil {
+			return err
+		}
+		if i, ok := index[nodeID]; ok {
+			entries[i].Tags = append(entries[i].Tags, name)
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,112 @@
+/*
+ * @Author: Vincent Yang
+ * @Date: 2026-10-17 16:18:02
+ * @LastEditors: Vincent Yang
+ * @LastEditTime: 2026-10-17 16:18:02
+ * @FilePath: /snell-panel/database/tokens.go
+ * @Telegram: https://t.me/missuo
+ * @GitHub: https://github.com/missuo
+ *
+ * Copyright © 2026 by Vincent, All Rights Reserved.
+ */
+
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"snell-panel/models"
+)
+
+// TokenRepository defines the storage operations for API tokens
+type TokenRepository interface {
+	// CreateToken inserts a new token and sets its ID and creation time
+	CreateToken(token *models.Token) error
+	// ListTokens returns every token ordered by ID
+	ListTokens() ([]models.Token, error)
+	// GetTokenByHash returns the token whose secret has the given hash
+	GetTokenByHash(hash string) (*models.Token, error)
+	// DeleteToken deletes the token with the given ID
+	DeleteToken(id int) error
+}
+
+// tokenColumns lists the tokens columns in the order scanToken expects
+const tokenColumns = "id, name, prefix, scopes, expires_at, created_at, token_hash"
+
+// scanToken scans a row selected with tokenColumns into a token
+func scanToken(row rowScanner) (models.Token, error) {
+	var token models.Token
+	var scopes string
+	var expiresAt sql.NullTime
+	err := row.Scan(&token.ID, &token.Name, &token.Prefix, &scopes, &expiresAt, &token.CreatedAt, &token.Hash)
+	if err != nil {
+		return token, err
+	}
+	token.Scopes = strings.Split(scopes, ",")
+	if expiresAt.Valid {
+		token.ExpiresAt = &expiresAt.Time
+	}
+	return token, nil
+}
+
+// CreateToken inserts a new token and sets its ID and creation time
+func (r *sqlRepository) CreateToken(token *models.Token) error {
+	token.CreatedAt = time.Now().UTC()
+	return r.db.QueryRow(`
+		 INSERT INTO tokens (name, token_hash, prefix, scopes, expires_at, created_at)
+		 VALUES ($1, $2, $3, $4, $5, $6)
+		 RETURNING id`,
+		token.Name, token.Hash, token.Prefix, strings.Join(token.Scopes, ","), token.ExpiresAt, token.CreatedAt).Scan(&token.ID)
+}
+
+// ListTokens returns every token ordered by ID
+func (r *sqlRepository) ListTokens() ([]models.Token, error) {
+	rows, err := r.db.Query("SELECT " + tokenColumns + " FROM tokens ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []models.Token
+	for rows.Next() {
+		token, err := scanToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+
+	return tokens, rows.Err()
+}
+
+// GetTokenByHash returns the token whose secret has the given hash
+func (r *sqlRepository) GetTokenByHash(hash string) (*models.Token, error) {
+	row := r.db.QueryRow("SELECT "+tokenColumns+" FROM tokens WHERE token_hash = $1", hash)
+	token, err := scanToken(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, models.ErrTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// DeleteToken deletes the token with the given ID
+func (r *sqlRepository) DeleteToken(id int) error {
+	result, err := r.db.Exec("DELETE FROM tokens WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return models.ErrTokenNotFound
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+/*
+ * @Author: Vincent Yang
+ * @Date: 2026-10-17 18:40:12
+ * @LastEditors: Vincent Yang
+ * @LastEditTime: 2026-10-17 18:40:12
+ * @FilePath: /snell-panel/geoip/geoip.go
+ * @Telegram: https://t.me/missuo
+ * @GitHub: https://github.com/missuo
+ *
+ * Copyright © 2026 by Vincent, All Rights Reserved.
+ */
+
+package geoip
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"snell-panel/models"
+	"snell-panel/utils"
+)
+
+// Provider names accepted in the GEOIP_PROVIDERS setting
+const (
+	ProviderIPSB = "ipsb"
+	ProviderMMDB = "mmdb"
+)
+
+// Provider looks up geolocation information for an IP address
+type Provider interface {
+	// Name identifies the provider in logs and errors
+	Name() string
+	// Lookup returns the geolocation information of an IP address
+	Lookup(ip string) (models.GeoIP, error)
+}
+
+// Chain tries each provider in order and returns the first successful lookup
+type Chain []Provider
+
+// Name identifies the provider in logs and errors
+func (c Chain) Name() string {
+	names := make([]string, len(c))
+	for i, provider := range c {
+		names[i] = provider.Name()
+	}
+	return strings.Join(names, ",")
+}
+
+// Lookup returns the geolocation information from the first provider
+// that succeeds, or the errors of every provider if all of them fail
+func (c Chain) Lookup(ip string) (models.GeoIP, error) {
+	var errs []error
+	for _, provider := range c {
+		geoIP, err := provider.Lookup(ip)
+		if err == nil {
+			return geoIP, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", provider.Name(), err))
+	}
+	return models.GeoIP{}, errors.Join(errs...)
+}
+
+// Close closes the providers of the chain that hold open files
+func (c Chain) Close() error {
+	var errs []error
+	for _, provider := range c {
+		errs = append(errs, Close(provider))
+	}
+	return errors.Join(errs...)
+}
+
+// Close releases the resources held by a provider, such as the database
+// files of the mmdb provider
+func Close(provider Provider) error {
+	if closer, ok := provider.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// Options configures the providers built by New
+type Options struct {
+	// Providers lists the provider names in fallback order
+	Providers []string
+	// CountryDB is the path of a MaxMind or DB-IP country mmdb file
+	CountryDB string
+	// ASNDB is the path of a MaxMind or DB-IP ASN mmdb file
+	ASNDB string
+}
+
+// New builds the provider chain described by the options
+func New(opts Options) (Provider, error) {
+	var chain Chain
+	for _, name := range opts.Providers {
+		switch strings.TrimSpace(name) {
+		case ProviderIPSB:
+			chain = append(chain, NewIPSB())
+		case ProviderMMDB:
+			mmdb, err := OpenMMDB(opts.CountryDB, opts.ASNDB)
+			if err != nil {
+				return nil, err
+			}
+			chain = append(chain, mmdb)
+		case "":
+		default:
+			return nil, fmt.Errorf("unknown geoip provider: %s", name)
+		}
+	}
+
+	if len(chain) == 0 {
+		return nil, errors.New("no geoip provider configured")
+	}
+	if len(chain) == 1 {
+		return chain[0], nil
+	}
+	return chain, nil
+}
+
+// ResolveAddresses fills in the IPv4 and IPv6 addresses of an entry.
+// An IP address in the ip field sets the address of its family and
+// keeps the other one as supplied, while a domain sets both from DNS.
+func ResolveAddresses(entry *models.Entry) error {
+	if ip := net.ParseIP(entry.IP); ip != nil {
+		if ip.To4() != nil {
+			entry.IPv4 = ip.String()
+		} else {
+			entry.IPv6 = ip.String()
+		}
+		return nil
+	}
+
+	addrs, err := utils.ResolveDomain(entry.IP)
+	if err != nil {
+		return err
+	}
+	entry.IPv4, entry.IPv6 = SplitAddresses(addrs)
+	return nil
+}
+
+// SplitAddresses returns the first IPv4 and the first IPv6 address of a list
+func SplitAddresses(addrs []string) (ipv4, ipv6 string) {
+	for _, addr := range addrs {
+		ip := net.ParseIP(addr)
+		switch {
+		case ip == nil:
+		case ip.To4() != nil:
+			if ipv4 == "" {
+				ipv4 = addr
+			}
+		case ipv6 == "":
+			ipv6 = addr
+		}
+	}
+	return ipv4, ipv6
+}
+
+// Locate looks up the geolocation of the IPv4 and IPv6 addresses of an
+// entry. The entry is only changed when every lookup succeeds.
+func Locate(provider Provider, entry *models.Entry) error {
+	preferred := entry.IPv4
+	if preferred == "" {
+		preferred = entry.IPv6
+	}
+	if preferred == "" {
+		return fmt.Errorf("no IP address found for %s", entry.IP)
+	}
+
+	geoIP, err := provider.Lookup(preferred)
+	if err != nil {
+		return fmt.Errorf("%w: %v", models.ErrGeoLookupFailed, err)
+	}
+
+	ipv6GeoIP := geoIP
+	if entry.IPv6 != "" && entry.IPv6 != preferred {
+		ipv6GeoIP, err = provider.Lookup(entry.IPv6)
+		if err != nil {
+			return fmt.Errorf("%w: %v", models.ErrGeoLookupFailed, err)
+		}
+	}
+
+	entry.SetGeoIP(geoIP)
+	if entry.IPv6 != "" {
+		entry.SetIPv6GeoIP(ipv6GeoIP)
+	} else {
+		entry.SetIPv6GeoIP(models.GeoIP{})
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+/*
+ * @Author: Vincent Yang
+ * @Date: 2026-10-17 18:40:12
+ * @LastEditors: Vincent Yang
+ * @LastEditTime: 2026-10-17 18:40:12
+ * @FilePath: /snell-panel/geoip/ipsb.go
+ * @Telegram: https://t.me/missuo
+ * @GitHub: https://github.com/missuo
+ *
+ * Copyright © 2026 by Vincent, All Rights Reserved.
+ */
+
+package geoip
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"snell-panel/models"
+)
+
+// ipsbTimeout bounds a single request to the ip.sb API
+const ipsbTimeout = 10 * time.Second
+
+// IPSB looks up geolocation information with the ip.sb web API
+type IPSB struct {
+	Client *http.Client
+}
+
+// NewIPSB creates a new IPSB provider
+func NewIPSB() *IPSB {
+	return &IPSB{
+		Client: &http.Client{Timeout: ipsbTimeout},
+	}
+}
+
+// Name identifies the provider in logs and errors
+func (p *IPSB) Name() string {
+	return ProviderIPSB
+}
+
+// Lookup retrieves geolocation information for an IP address
+func (p *IPSB) Lookup(ip string) (models.GeoIP, error) {
+	url := fmt.Sprintf("https://api.ip.sb/geoip/%s", ip)
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return models.GeoIP{}, err
+	}
+
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/128.0.0.0 Safari/537.36")
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return models.GeoIP{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return models.GeoIP{}, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return models.GeoIP{}, err
+	}
+
+	var geoIP models.GeoIP
+	err = json.Unmarshal(body, &geoIP)
+	if err != nil {
+		return models.GeoIP{}, err
+	}
+
+	return geoIP, nil
+}
@@ -0,0 +1,130 @@
+/*
+ * @Author: Vincent Yang
+ * @Date: 2026-10-17 18:52:37
+ * @LastEditors: Vincent Yang
+ * @LastEditTime: 2026-10-17 18:52:37
+ * @FilePath: /snell-panel/geoip/mmdb.go
+ * @Telegram: https://t.me/missuo
+ * @GitHub: https://github.com/missuo
+ *
+ * Copyright © 2026 by Vincent, All Rights Reserved.
+ */
+
+package geoip
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"snell-panel/models"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// mmdbCountryRecord is the subset of a country database record we read.
+// MaxMind GeoLite2/GeoIP2 and DB-IP databases share this layout.
+type mmdbCountryRecord struct {
+	Continent struct {
+		Code string `maxminddb:"code"`
+	} `maxminddb:"continent"`
+	Country struct {
+		ISOCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"country"`
+}
+
+// mmdbASNRecord is the subset of an ASN database record we read
+type mmdbASNRecord struct {
+	Number       int    `maxminddb:"autonomous_system_number"`
+	Organization string `maxminddb:"autonomous_system_organization"`
+}
+
+// MMDB looks up geolocation information in local mmdb files
+type MMDB struct {
+	country *maxminddb.Reader
+	asn     *maxminddb.Reader
+}
+
+// OpenMMDB opens the country and ASN databases. Either path may be
+// empty, but not both.
+func OpenMMDB(countryPath, asnPath string) (*MMDB, error) {
+	if countryPath == "" && asnPath == "" {
+		return nil, errors.New("mmdb provider needs GEOIP_COUNTRY_DB or GEOIP_ASN_DB")
+	}
+
+	db := &MMDB{}
+	if countryPath != "" {
+		reader, err := maxminddb.Open(countryPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open country database: %w", err)
+		}
+		db.country = reader
+	}
+	if asnPath != "" {
+		reader, err := maxminddb.Open(asnPath)
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to open ASN database: %w", err)
+		}
+		db.asn = reader
+	}
+
+	return db, nil
+}
+
+// Name identifies the provider in logs and errors
+func (p *MMDB) Name() string {
+	return ProviderMMDB
+}
+
+// Lookup reads the geolocation information of an IP address from the
+// local databases
+func (p *MMDB) Lookup(ip string) (models.GeoIP, error) {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return models.GeoIP{}, fmt.Errorf("invalid IP address: %s", ip)
+	}
+
+	geoIP := models.GeoIP{IP: ip}
+
+	if p.country != nil {
+		var record mmdbCountryRecord
+		if err := p.country.Lookup(addr, &record); err != nil {
+			return models.GeoIP{}, err
+		}
+		geoIP.CountryCode = record.Country.ISOCode
+		geoIP.Country = record.Country.Names["en"]
+		geoIP.ContinentCode = record.Continent.Code
+	}
+
+	if p.asn != nil {
+		var record mmdbASNRecord
+		if err := p.asn.Lookup(addr, &record); err != nil {
+			return models.GeoIP{}, err
+		}
+		geoIP.ASN = record.Number
+		geoIP.ASNOrganization = record.Organization
+		// ASN databases have no ISP field, the AS organization is the closest match
+		geoIP.ISP = record.Organization
+		geoIP.Organization = record.Organization
+	}
+
+	if geoIP.CountryCode == "" && geoIP.ASN == 0 {
+		return models.GeoIP{}, fmt.Errorf("no record for %s", ip)
+	}
+
+	return geoIP, nil
+}
+
+// Close closes the underlying database files
+func (p *MMDB) Close() error {
+	var errs []error
+	if p.country != nil {
+		errs = append(errs, p.country.Close())
+	}
+	if p.asn != nil {
+		errs = append(errs, p.asn.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,62 @@
+/*
+ * @Author: Vincent Yang
+ * @Date: 2026-10-17 09:55:12
+ * @LastEditors: Vincent Yang
+ * @LastEditTime: 2026-10-17 09:55:12
+ * @FilePath: /snell-panel/handlers/cron.go
+ * @Telegram: https://t.me/missuo
+ * @GitHub: https://github.com/missuo
+ *
+ * Copyright © 2026 by Vincent, All Rights Reserved.
+ */
+
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"snell-panel/models"
+)
+
+// RetryGeoLookups handles running one pass of the geolocation retry
+// worker, meant to be called by a cron job where the server doesn't run
+// its background workers
+func (h *Handlers) RetryGeoLookups(c *gin.Context) {
+	if err := h.Service.RetryGeoLookups(c.Request.Context()); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ApiResponse{
+		Status:  "success",
+		Message: "Pending geolocation lookups retried",
+	})
+}
+
+// ProbeNodes handles running one pass of the health prober
+func (h *Handlers) ProbeNodes(c *gin.Context) {
+	if err := h.Service.ProbeNodes(c.Request.Context()); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ApiResponse{
+		Status:  "success",
+		Message: "Nodes probed",
+	})
+}
+
+// ResolveDomains handles running one pass of the domain resolver
+func (h *Handlers) ResolveDomains(c *gin.Context) {
+	if err := h.Service.ResolveDomains(c.Request.Context()); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ApiResponse{
+		Status:  "success",
+		Message: "Domain nodes resolved",
+	})
+}
@@ -0,0 +1,69 @@
+/*
+ * @Author: Vincent Yang
+ * @Date: 2026-10-17 21:48:03
+ * @LastEditors: Vincent Yang
+ * @LastEditTime: 2026-10-17 21:48:03
+ * @FilePath: /snell-panel/handlers/errors.go
+ * @Telegram: https://t.me/missuo
+ * @GitHub: https://github.com/missuo
+ *
+ * Copyright © 2026 by Vincent, All Rights Reserved.
+ */
+
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"snell-panel/models"
+)
+
+// respondError aborts the request with an error response
+func respondError(c *gin.Context, status int, code, message string) {
+	c.AbortWithStatusJSON(status, models.ApiResponse{
+		Status:  "error",
+		Code:    code,
+		Message: message,
+	})
+}
+
+// writeError maps an error returned by the service to an error response.
+// Unexpected errors are logged and reported without their details, so
+// database messages never reach clients.
+func writeError(c *gin.Context, err error) {
+	var validationErr *models.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		c.AbortWithStatusJSON(http.StatusBadRequest, models.ApiResponse{
+			Status:  "error",
+			Code:    models.CodeValidationFailed,
+			Message: "Validation failed",
+			Errors:  validationErr.Fields,
+		})
+	case errors.Is(err, models.ErrNoFieldsToUpdate):
+		respondError(c, http.StatusBadRequest, models.CodeValidationFailed, "No fields to update")
+	case errors.Is(err, models.ErrInvalidRequest):
+		respondError(c, http.StatusBadRequest, models.CodeValidationFailed, err.Error())
+	case errors.Is(err, models.ErrNotFound):
+		respondError(c, http.StatusNotFound, models.CodeNotFound, "Entry not found")
+	case errors.Is(err, models.ErrTokenNotFound):
+		respondError(c, http.StatusNotFound, models.CodeNotFound, "Token not found")
+	case errors.Is(err, models.ErrSubscriptionNotFound):
+		respondError(c, http.StatusNotFound, models.CodeNotFound, "Subscription not found")
+	case errors.Is(err, models.ErrNoEntries):
+		respondError(c, http.StatusNotFound, models.CodeNotFound, "No entries found for subscription")
+	case errors.Is(err, models.ErrConflict):
+		respondError(c, http.StatusConflict, models.CodeConflict, err.Error())
+	case errors.Is(err, models.ErrGeoLookupFailed):
+		respondError(c, http.StatusBadGateway, models.CodeGeoLookupFailed, err.Error())
+	case errors.Is(err, models.ErrInvalidToken):
+		respondError(c, http.StatusUnauthorized, models.CodeUnauthorized, "Unauthorized")
+	default:
+		log.Printf("%s %s failed: %v", c.Request.Method, c.FullPath(), err)
+		respondError(c, http.StatusInternalServerError, models.CodeInternalError, "Internal server error")
+	}
+}
@@ -0,0 +1,58 @@
+/*
+ * @Author: Vincent Yang
+ * @Date: 2026-10-17 22:58:37
+ * @LastEditors: Vincent Yang
+ * @LastEditTime: 2026-10-17 22:58:37
+ * @FilePath: /snell-panel/handlers/etag.go
+ * @Telegram: https://t.me/missuo
+ * @GitHub: https://github.com/missuo
+ *
+ * Copyright © 2026 by Vincent, All Rights Reserved.
+ */
+
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// writeJSONWithETag writes a JSON response tagged with a strong ETag
+// derived from its body, or 304 Not Modified when the request's
+// If-None-Match already holds that ETag
+func writeJSONWithETag(c *gin.Context, status int, body interface{}) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	sum := sha256.Sum256(data)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	c.Header("ETag", etag)
+	// Clients may cache the entry but must revalidate before using it
+	c.Header("Cache-Control", "private, no-cache")
+
+	if etagMatches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Data(status, "application/json; charset=utf-8", data)
+}
+
+// etagMatches reports whether an If-None-Match header matches an ETag.
+// Weak validators match too, as If-None-Match uses weak comparison.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -13,57 +13,227 @@
 package handlers
 
 import (
-	"database/sql"
+	"context"
 	"fmt"
+	"net"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 
 	"snell-panel/models"
-	"snell-panel/utils"
+	"snell-panel/subscription"
 )
 
+// EntryService defines the business operations the handlers depend on
+type EntryService interface {
+	InsertEntry(entry *models.Entry) (*models.Entry, error)
+	DeleteEntryByIP(ip string) error
+	DeleteEntryByNodeID(nodeID string) error
+	QueryEntries(query models.EntryQuery) (*models.EntryPage, error)
+	GetEntry(nodeID string) (*models.Entry, error)
+	GetResolutions(nodeID string) ([]models.Resolution, error)
+	GetSubscription(req subscription.Request) (*subscription.Document, error)
+	ModifyNodeByNodeID(nodeID string, modifyReq *models.ModifyRequest) error
+	PatchEntry(nodeID string, modifyReq *models.ModifyRequest) (*models.Entry, error)
+}
+
+// TokenService defines the API token operations the handlers depend on
+type TokenService interface {
+	Authenticate(secret string) (*models.Token, error)
+	CreateToken(req *models.CreateTokenRequest) (*models.Token, error)
+	ListTokens() ([]models.Token, error)
+	RevokeToken(id int) error
+}
+
+// TagService defines the node tag operations the handlers depend on
+type TagService interface {
+	ListTags() ([]models.Tag, error)
+	TagEntries(req *models.TagRequest) error
+	UntagEntries(req *models.TagRequest) error
+}
+
+// SubscriptionService defines the saved subscription operations the
+// handlers depend on
+type SubscriptionService interface {
+	CreateSavedSubscription(req *models.SavedSubscriptionRequest) (*models.SavedSubscription, error)
+	ListSavedSubscriptions() ([]models.SavedSubscription, error)
+	GetSavedSubscription(id int) (*models.SavedSubscription, error)
+	UpdateSavedSubscription(id int, req *models.SavedSubscriptionRequest) (*models.SavedSubscription, error)
+	RotateSavedSubscription(id int) (*models.SavedSubscription, error)
+	DeleteSavedSubscription(id int) error
+	RenderSavedSubscription(slug string, profile subscription.ProfileOptions) (*subscription.Document, error)
+}
+
+// WorkerService defines the background worker passes the handlers can
+// run on request
+type WorkerService interface {
+	RetryGeoLookups(ctx context.Context) error
+	ProbeNodes(ctx context.Context) error
+	ResolveDomains(ctx context.Context) error
+}
+
+// Service groups every operation the handlers depend on
+type Service interface {
+	EntryService
+	TokenService
+	TagService
+	SubscriptionService
+	WorkerService
+}
+
 // Handlers contains the HTTP request handlers
 type Handlers struct {
-	DB    *sql.DB
-	Token string
+	Service Service
+	// PublicURL is the scheme and host that generated links point to,
+	// detected from each request when empty
+	PublicURL string
+	// TrustedProxies are the networks whose X-Forwarded-Proto header is
+	// honored when detecting the scheme
+	TrustedProxies []*net.IPNet
 }
 
 // NewHandlers creates a new Handlers instance
-func NewHandlers(db *sql.DB, token string) *Handlers {
+func NewHandlers(svc Service) *Handlers {
 	return &Handlers{
-		DB:    db,
-		Token: token,
+		Service: svc,
 	}
 }
 
+// RegisterRoutes registers every API route on r
+func (h *Handlers) RegisterRoutes(r *gin.Engine) {
+	r.GET("/", h.Welcome)
+	r.POST("/entry", h.AuthMiddleware(models.ScopeEntriesWrite), h.InsertEntry)
+	r.GET("/entries", h.AuthMiddleware(models.ScopeEntriesRead), h.QueryEntries)
+	r.DELETE("/entry/:ip", h.AuthMiddleware(models.ScopeEntriesWrite), h.DeleteEntryByIP)
+	r.DELETE("/entry/node/:node_id", h.AuthMiddleware(models.ScopeEntriesWrite), h.DeleteEntryByNodeID)
+	r.GET("/entry/node/:node_id", h.AuthMiddleware(models.ScopeEntriesRead), h.GetEntry)
+	r.GET("/entry/node/:node_id/resolutions", h.AuthMiddleware(models.ScopeEntriesRead), h.GetResolutions)
+	r.GET("/subscribe", h.QueryAuthMiddleware(models.ScopeSubscribe), h.GetSubscription)
+	r.GET("/profile", h.QueryAuthMiddleware(models.ScopeSubscribe), h.GetProfile)
+	r.PATCH("/entry/node/:node_id", h.AuthMiddleware(models.ScopeEntriesWrite), h.PatchEntry)
+	r.PUT("/modify/:id", h.AuthMiddleware(models.ScopeEntriesWrite), h.ModifyNodeByNodeID)
+	r.GET("/tags", h.AuthMiddleware(models.ScopeEntriesRead), h.ListTags)
+	r.POST("/tags/assign", h.AuthMiddleware(models.ScopeEntriesWrite), h.TagEntries)
+	r.POST("/tags/unassign", h.AuthMiddleware(models.ScopeEntriesWrite), h.UntagEntries)
+	r.POST("/subscriptions", h.AuthMiddleware(models.ScopeAdmin), h.CreateSavedSubscription)
+	r.GET("/subscriptions", h.AuthMiddleware(models.ScopeAdmin), h.ListSavedSubscriptions)
+	r.GET("/subscriptions/:id", h.AuthMiddleware(models.ScopeAdmin), h.GetSavedSubscription)
+	r.PUT("/subscriptions/:id", h.AuthMiddleware(models.ScopeAdmin), h.UpdateSavedSubscription)
+	r.POST("/subscriptions/:id/rotate", h.AuthMiddleware(models.ScopeAdmin), h.RotateSavedSubscription)
+	r.DELETE("/subscriptions/:id", h.AuthMiddleware(models.ScopeAdmin), h.DeleteSavedSubscription)
+	r.GET("/sub/:slug", h.GetSharedSubscription)
+	r.POST("/tokens", h.AuthMiddleware(models.ScopeAdmin), h.CreateToken)
+	r.GET("/tokens", h.AuthMiddleware(models.ScopeAdmin), h.ListTokens)
+	r.DELETE("/tokens/:id", h.AuthMiddleware(models.ScopeAdmin), h.RevokeToken)
+	r.GET("/cron/geo", h.AuthMiddleware(models.ScopeEntriesWrite), h.RetryGeoLookups)
+	r.GET("/cron/probe", h.AuthMiddleware(models.ScopeEntriesWrite), h.ProbeNodes)
+	r.GET("/cron/resolve", h.AuthMiddleware(models.ScopeEntriesWrite), h.ResolveDomains)
+	r.NoRoute(h.NotFound)
+}
+
 // CorsMiddleware returns a CORS middleware configured for the API
 func CorsMiddleware() gin.HandlerFunc {
 	config := cors.DefaultConfig()
 	config.AllowAllOrigins = true
-	config.AllowMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
-	config.AllowHeaders = []string{"Origin", "Content-Type", "Accept"}
+	config.AllowMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+	config.AllowHeaders = []string{"Origin", "Content-Type", "Accept", "Authorization", "X-API-Token"}
 	return cors.New(config)
 }
 
-// AuthMiddleware returns a middleware that checks for API token
-func (h *Handlers) AuthMiddleware() gin.HandlerFunc {
+// tokenContextKey is the gin context key holding the authenticated token
+const tokenContextKey = "token"
+
+// AuthMiddleware returns a middleware that checks for an API token
+// granting the required scope in the request headers
+func (h *Handlers) AuthMiddleware(scope string) gin.HandlerFunc {
+	return h.authMiddleware(scope, false)
+}
+
+// QueryAuthMiddleware is like AuthMiddleware but also accepts the token
+// as a query parameter, for subscription clients that can't set headers
+func (h *Handlers) QueryAuthMiddleware(scope string) gin.HandlerFunc {
+	return h.authMiddleware(scope, true)
+}
+
+// authMiddleware returns a middleware that checks for an API token
+// granting the required scope
+func (h *Handlers) authMiddleware(scope string, allowQuery bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		providedToken := c.Query("token")
-		if providedToken != h.Token {
-			c.JSON(http.StatusUnauthorized, models.ApiResponse{
-				Status:  "error",
-				Message: "Unauthorized",
-			})
-			c.Abort()
+		token, err := h.Service.Authenticate(requestToken(c, allowQuery))
+		if err != nil {
+			writeError(c, err)
 			return
 		}
+		if !token.HasScope(scope) {
+			respondError(c, http.StatusForbidden, models.CodeForbidden, fmt.Sprintf("Token lacks the %s scope", scope))
+			return
+		}
+		c.Set(tokenContextKey, token)
 		c.Next()
 	}
 }
 
+// requestToken extracts the API token from the Authorization or
+// X-API-Token header, falling back to the token query parameter
+// when allowQuery is set
+func requestToken(c *gin.Context, allowQuery bool) string {
+	if authorization := c.GetHeader("Authorization"); authorization != "" {
+		scheme, credentials, ok := strings.Cut(authorization, " ")
+		if ok && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(credentials)
+		}
+	}
+	if token := c.GetHeader("X-API-Token"); token != "" {
+		return token
+	}
+	if allowQuery {
+		return c.Query("token")
+	}
+	return ""
+}
+
+// RedactedLogger returns gin's request logger with the token query
+// parameter masked, so secrets don't end up in access logs
+func RedactedLogger() gin.HandlerFunc {
+	return gin.LoggerWithFormatter(func(param gin.LogFormatterParams) string {
+		return fmt.Sprintf("[GIN] %v | %3d | %13v | %15s | %-7s %#v\n%s",
+			param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+			param.StatusCode,
+			param.Latency,
+			param.ClientIP,
+			param.Method,
+			redactQuery(param.Path),
+			param.ErrorMessage,
+		)
+	})
+}
+
+// redactQuery masks the token query parameter of a request path, and
+// the slug of a saved subscription URL
+func redactQuery(path string) string {
+	if strings.HasPrefix(path, "/sub/") {
+		_, rawQuery, _ := strings.Cut(path, "?")
+		path = "/sub/REDACTED"
+		if rawQuery != "" {
+			path += "?" + rawQuery
+		}
+	}
+	base, rawQuery, ok := strings.Cut(path, "?")
+	if !ok {
+		return path
+	}
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil || !query.Has("token") {
+		return path
+	}
+	query.Set("token", "REDACTED")
+	return base + "?" + query.Encode()
+}
+
 // Welcome handles the root route
 func (h *Handlers) Welcome(c *gin.Context) {
 	c.JSON(http.StatusOK, models.ApiResponse{
@@ -74,69 +244,27 @@ func (h *Handlers) Welcome(c *gin.Context) {
 
 // NotFound handles not found routes
 func (h *Handlers) NotFound(c *gin.Context) {
-	c.JSON(http.StatusNotFound, models.ApiResponse{
-		Status:  "error",
-		Message: "Path not found",
-	})
+	respondError(c, http.StatusNotFound, models.CodeNotFound, "Path not found")
 }
 
 // InsertEntry handles creating a new entry
 func (h *Handlers) InsertEntry(c *gin.Context) {
 	var entry models.Entry
 	if err := c.BindJSON(&entry); err != nil {
-		c.JSON(http.StatusBadRequest, models.ApiResponse{
-			Status:  "error",
-			Message: err.Error(),
-		})
+		respondError(c, http.StatusBadRequest, models.CodeBadRequest, err.Error())
 		return
 	}
 
-	// Resolve domain to IP if needed and get IP information
-	// Keep original domain/IP in entry.IP, only use resolved IP for getting geo info
-	originalIP := entry.IP
-	_, ipInfo, err := utils.GetIPInfoFromDomainOrIP(entry.IP)
+	created, err := h.Service.InsertEntry(&entry)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ApiResponse{
-			Status:  "error",
-			Message: fmt.Sprintf("Failed to resolve domain/IP or get IP info: %v", err),
-		})
+		writeError(c, err)
 		return
 	}
 
-	// Update entry with IP information (but keep original domain/IP)
-	entry.IP = originalIP // Keep the original domain/IP address
-	entry.CountryCode = ipInfo.CountryCode
-	entry.ISP = ipInfo.ISP
-	entry.ASN = ipInfo.ASN
-	entry.NodeID = utils.GenerateUUID()
-
-	// Set default version if not provided
-	if entry.Version == "" {
-		entry.Version = "4"
-	}
-
-	// Insert entry into database
-	var id int
-	err = h.DB.QueryRow(`
-		 INSERT INTO entries (ip, port, psk, country_code, isp, asn, node_id, node_name, version) 
-		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) 
-		 RETURNING id`,
-		entry.IP, entry.Port, entry.PSK, entry.CountryCode, entry.ISP, entry.ASN, entry.NodeID, entry.NodeName, entry.Version).Scan(&id)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ApiResponse{
-			Status:  "error",
-			Message: err.Error(),
-		})
-		return
-	}
-
-	// Set ID in entry
-	entry.ID = id
-
 	c.JSON(http.StatusCreated, models.ApiResponse{
 		Status:  "success",
 		Message: "Entry created successfully",
-		Data:    entry,
+		Data:    created,
 	})
 }
 
@@ -144,21 +272,8 @@ func (h *Handlers) InsertEntry(c *gin.Context) {
 func (h *Handlers) DeleteEntryByIP(c *gin.Context) {
 	ip := c.Param("ip")
 
-	result, err := h.DB.Exec("DELETE FROM entries WHERE ip = $1", ip)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ApiResponse{
-			Status:  "error",
-			Message: err.Error(),
-		})
-		return
-	}
-
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		c.JSON(http.StatusNotFound, models.ApiResponse{
-			Status:  "error",
-			Message: "Entry not found",
-		})
+	if err := h.Service.DeleteEntryByIP(ip); err != nil {
+		writeError(c, err)
 		return
 	}
 
@@ -172,281 +287,361 @@ func (h *Handlers) DeleteEntryByIP(c *gin.Context) {
 func (h *Handlers) DeleteEntryByNodeID(c *gin.Context) {
 	nodeID := c.Param("node_id")
 
-	result, err := h.DB.Exec("DELETE FROM entries WHERE node_id = $1", nodeID)
+	if err := h.Service.DeleteEntryByNodeID(nodeID); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ApiResponse{
+		Status:  "success",
+		Message: "Entry deleted successfully",
+	})
+}
+
+// QueryEntries handles listing entries, optionally filtered, sorted and
+// paginated by the query parameters
+func (h *Handlers) QueryEntries(c *gin.Context) {
+	query, err := entryQuery(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ApiResponse{
-			Status:  "error",
-			Message: err.Error(),
-		})
+		writeError(c, err)
 		return
 	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		c.JSON(http.StatusNotFound, models.ApiResponse{
-			Status:  "error",
-			Message: "Entry not found",
-		})
+	page, err := h.Service.QueryEntries(query)
+	if err != nil {
+		writeError(c, err)
 		return
 	}
 
+	entries := page.Entries
+	if entries == nil {
+		entries = []models.Entry{}
+	}
+
 	c.JSON(http.StatusOK, models.ApiResponse{
 		Status:  "success",
-		Message: "Entry deleted successfully",
+		Message: "Entries retrieved successfully",
+		Data:    entries,
+		Meta:    &page.Meta,
 	})
 }
 
-// QueryAllEntries handles retrieving all entries
-func (h *Handlers) QueryAllEntries(c *gin.Context) {
-	rows, err := h.DB.Query(`
-		 SELECT id, ip, port, psk, country_code, isp, asn, node_id, node_name, version 
-		 FROM entries
-		 ORDER BY id
-	 `)
+// entryQuery reads the filter, sort and pagination query parameters of
+// an entry listing. A sort field prefixed with "-" sorts descending.
+func entryQuery(c *gin.Context) (models.EntryQuery, error) {
+	query := models.EntryQuery{
+		CountryCode: c.Query("country"),
+		ISP:         c.Query("isp"),
+		Version:     c.Query("version"),
+		Name:        c.Query("name"),
+		Address:     c.Query("address"),
+		Cursor:      c.Query("cursor"),
+	}
+	query.Sort, query.Desc = strings.CutPrefix(c.Query("sort"), "-")
+
+	var errs []models.FieldError
+	if asn := c.Query("asn"); asn != "" {
+		value, err := strconv.Atoi(strings.TrimPrefix(strings.ToUpper(asn), "AS"))
+		if err != nil || value <= 0 {
+			errs = append(errs, models.FieldError{Field: "asn", Message: "must be a positive AS number"})
+		}
+		query.ASN = value
+	}
+	tags, excludeTags, err := tagFilters(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ApiResponse{
-			Status:  "error",
-			Message: err.Error(),
-		})
-		return
+		errs = append(errs, models.FieldError{Field: "tags", Message: err.Error()})
 	}
-	defer rows.Close()
-
-	var entries []models.Entry
-	for rows.Next() {
-		var entry models.Entry
-		if err := rows.Scan(
-			&entry.ID, &entry.IP, &entry.Port, &entry.PSK,
-			&entry.CountryCode, &entry.ISP, &entry.ASN,
-			&entry.NodeID, &entry.NodeName, &entry.Version,
-		); err != nil {
-			c.JSON(http.StatusInternalServerError, models.ApiResponse{
-				Status:  "error",
-				Message: err.Error(),
-			})
-			return
+	query.Tags, query.ExcludeTags = tags, excludeTags
+	if limit := c.Query("limit"); limit != "" {
+		value, err := strconv.Atoi(limit)
+		if err != nil || value <= 0 {
+			errs = append(errs, models.FieldError{Field: "limit", Message: "must be a positive integer"})
 		}
-		entries = append(entries, entry)
+		query.Limit = value
 	}
+	if len(errs) > 0 {
+		return query, &models.ValidationError{Fields: errs}
+	}
+	return query, nil
+}
 
-	if len(entries) == 0 {
-		c.JSON(http.StatusNotFound, models.ApiResponse{
-			Status:  "warning",
-			Message: "No entries found",
-		})
+// GetEntry handles retrieving a single entry by node ID. The response
+// carries an ETag so clients polling the entry can revalidate it with
+// If-None-Match and receive 304 Not Modified while it is unchanged.
+func (h *Handlers) GetEntry(c *gin.Context) {
+	entry, err := h.Service.GetEntry(c.Param("node_id"))
+	if err != nil {
+		writeError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, models.ApiResponse{
+	writeJSONWithETag(c, http.StatusOK, models.ApiResponse{
 		Status:  "success",
-		Message: "Entries retrieved successfully",
-		Data:    entries,
+		Message: "Entry retrieved successfully",
+		Data:    entry,
 	})
 }
 
-// GetSubscription handles generating a subscription string
-func (h *Handlers) GetSubscription(c *gin.Context) {
-	// Get the via, filter, and flag parameters from query string
-	via := c.Query("via")
-	filter := c.Query("filter")
-	flagParam := c.Query("flag")
-	
-	// Default flag to true, set to false only if explicitly set to "false"
-	showFlag := true
-	if flagParam == "false" {
-		showFlag = false
-	}
-	
-	var query string
-	var args []interface{}
-	
-	if filter != "" {
-		// Filter nodes by node name containing the keyword
-		query = `
-			SELECT ip, port, psk, country_code, isp, asn, node_id, node_name, version 
-			FROM entries
-			WHERE node_name LIKE $1
-			ORDER BY id
-		`
-		args = []interface{}{"%" + filter + "%"}
-	} else {
-		query = `
-			SELECT ip, port, psk, country_code, isp, asn, node_id, node_name, version 
-			FROM entries
-			ORDER BY id
-		`
-	}
-	
-	rows, err := h.DB.Query(query, args...)
+// GetResolutions handles listing the resolution history of a domain node
+func (h *Handlers) GetResolutions(c *gin.Context) {
+	resolutions, err := h.Service.GetResolutions(c.Param("node_id"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ApiResponse{
-			Status:  "error",
-			Message: err.Error(),
-		})
+		writeError(c, err)
 		return
 	}
-	defer rows.Close()
-
-	var subscriptionLines []string
-	for rows.Next() {
-		var entry models.Entry
-		if err := rows.Scan(
-			&entry.IP, &entry.Port, &entry.PSK,
-			&entry.CountryCode, &entry.ISP, &entry.ASN,
-			&entry.NodeID, &entry.NodeName, &entry.Version,
-		); err != nil {
-			c.JSON(http.StatusInternalServerError, models.ApiResponse{
-				Status:  "error",
-				Message: err.Error(),
-			})
-			return
-		}
 
-		emojiFlag := utils.CountryCodeToFlagEmoji(entry.CountryCode)
-		nodeName := entry.NodeName
-		if nodeName == "" {
-			if showFlag {
-				nodeName = fmt.Sprintf("%s %s AS%d %s %s",
-					emojiFlag, entry.CountryCode, entry.ASN, entry.ISP, entry.NodeID)
-			} else {
-				nodeName = fmt.Sprintf("%s AS%d %s %s",
-					entry.CountryCode, entry.ASN, entry.ISP, entry.NodeID)
-			}
-		} else {
-			if showFlag {
-				nodeName = fmt.Sprintf("%s %s", emojiFlag, entry.NodeName)
-			} else {
-				nodeName = entry.NodeName
-			}
-		}
-		
-		// Add - xxx suffix to node name when via parameter is provided
-		if via != "" {
-			nodeName = fmt.Sprintf("%s - %s", nodeName, via)
-		}
+	c.JSON(http.StatusOK, models.ApiResponse{
+		Status:  "success",
+		Message: "Resolutions retrieved successfully",
+		Data:    resolutions,
+	})
+}
 
-		var line string
-		if via != "" {
-			// Include underlying-proxy parameter when via is specified
-			line = fmt.Sprintf("%s = snell, %s, %d, psk = %s, version = %s, underlying-proxy = %s",
-				nodeName, entry.IP, entry.Port, entry.PSK, entry.Version, via)
-		} else {
-			line = fmt.Sprintf("%s = snell, %s, %d, psk = %s, version = %s",
-				nodeName, entry.IP, entry.Port, entry.PSK, entry.Version)
+// subscriptionOptions reads the node naming parameters shared by the
+// subscription and profile routes from the query string
+func subscriptionOptions(c *gin.Context) (subscription.Options, error) {
+	ipVersion, err := subscription.ParseIPVersion(c.Query("ip_version"))
+	if err != nil {
+		return subscription.Options{}, fmt.Errorf("invalid ip_version value: %s", c.Query("ip_version"))
+	}
+
+	// Default flag to true, set to false only if explicitly set to "false"
+	return subscription.Options{
+		Via:       c.Query("via"),
+		ShowFlag:  c.Query("flag") != "false",
+		IPVersion: ipVersion,
+	}, nil
+}
+
+// subscriptionRules reads the include and exclude patterns and the
+// ordered rename rules, written as pattern=>replacement, from the query string
+func subscriptionRules(c *gin.Context) (subscription.Rules, error) {
+	var rules subscription.Rules
+	var err error
+	if rules.Include, err = subscription.CompilePattern(c.Query("include")); err != nil {
+		return rules, fmt.Errorf("include: %w", err)
+	}
+	if rules.Exclude, err = subscription.CompilePattern(c.Query("exclude")); err != nil {
+		return rules, fmt.Errorf("exclude: %w", err)
+	}
+
+	var renames []models.RenameRule
+	for _, value := range c.QueryArray("rename") {
+		rule, err := subscription.ParseRenameRule(value)
+		if err != nil {
+			return rules, err
 		}
-		subscriptionLines = append(subscriptionLines, line)
+		renames = append(renames, rule)
 	}
+	if rules.Rename, err = subscription.CompileRename(renames); err != nil {
+		return rules, fmt.Errorf("rename: %w", err)
+	}
+	return rules, nil
+}
 
-	if len(subscriptionLines) == 0 {
-		c.JSON(http.StatusNotFound, models.ApiResponse{
-			Status:  "error",
-			Message: "No entries found for subscription",
-		})
+// writeSubscription renders a subscription request and writes the document
+func (h *Handlers) writeSubscription(c *gin.Context, req subscription.Request) {
+	doc, err := h.Service.GetSubscription(req)
+	if err != nil {
+		writeError(c, err)
 		return
 	}
 
-	c.String(http.StatusOK, strings.Join(subscriptionLines, "\n"))
+	c.Data(http.StatusOK, doc.ContentType, doc.Body)
 }
 
-// ModifyNodeByNodeID handles modifying a node by its NodeID
-func (h *Handlers) ModifyNodeByNodeID(c *gin.Context) {
-	nodeID := c.Param("id")
+// GetSubscription handles generating a subscription string
+func (h *Handlers) GetSubscription(c *gin.Context) {
+	req, err := parseSubscriptionRequest(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, models.CodeValidationFailed, err.Error())
+		return
+	}
+	if req.Format == subscription.FormatSurgeProfile {
+		h.writeProfile(c, req)
+		return
+	}
+	h.writeSubscription(c, req)
+}
 
-	var modifyReq models.ModifyRequest
-	if err := c.BindJSON(&modifyReq); err != nil {
-		c.JSON(http.StatusBadRequest, models.ApiResponse{
-			Status:  "error",
-			Message: err.Error(),
-		})
+// GetProfile handles generating a complete Surge managed profile
+func (h *Handlers) GetProfile(c *gin.Context) {
+	req, err := parseSubscriptionRequest(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, models.CodeValidationFailed, err.Error())
 		return
 	}
+	req.Format = subscription.FormatSurgeProfile
+	h.writeProfile(c, req)
+}
+
+// writeProfile reads the managed profile parameters and writes the profile
+func (h *Handlers) writeProfile(c *gin.Context, req subscription.Request) {
+	interval := subscription.DefaultProfileInterval
+	if intervalParam := c.Query("interval"); intervalParam != "" {
+		var err error
+		interval, err = strconv.Atoi(intervalParam)
+		if err != nil || interval <= 0 {
+			respondError(c, http.StatusBadRequest, models.CodeValidationFailed, fmt.Sprintf("Invalid interval: %s", intervalParam))
+			return
+		}
+	}
+
+	req.Profile = subscription.ProfileOptions{
+		URL:      h.requestURL(c),
+		Interval: interval,
+		Strict:   c.Query("strict") == "true",
+	}
+	h.writeSubscription(c, req)
+}
+
+// parseSubscriptionRequest reads the query parameters shared by the
+// subscription and profile routes. Its errors are meant for the client.
+func parseSubscriptionRequest(c *gin.Context) (subscription.Request, error) {
+	var req subscription.Request
+	var err error
+
+	req.Format, err = subscription.ParseFormat(c.Query("format"))
+	if err != nil {
+		return req, fmt.Errorf("unsupported subscription format: %s", c.Query("format"))
+	}
 
-	// Build query based on which fields are provided
-	query := "UPDATE entries SET"
-	var args []interface{}
-	var setStatements []string
-	paramIndex := 1
+	req.HealthyOnly, err = optionalBool(c, "healthy_only")
+	if err != nil {
+		return req, fmt.Errorf("invalid healthy_only value: %s", c.Query("healthy_only"))
+	}
+
+	req.Options, err = subscriptionOptions(c)
+	if err != nil {
+		return req, err
+	}
+
+	req.Tags, req.ExcludeTags, err = tagFilters(c)
+	if err != nil {
+		return req, fmt.Errorf("invalid tag filter: %v", err)
+	}
 
-	if modifyReq.NodeName != "" {
-		setStatements = append(setStatements, fmt.Sprintf(" node_name = $%d", paramIndex))
-		args = append(args, modifyReq.NodeName)
-		paramIndex++
+	req.Options.Rules, err = subscriptionRules(c)
+	if err != nil {
+		return req, fmt.Errorf("invalid rule: %v", err)
 	}
 
-	if modifyReq.IP != "" {
-		// Resolve domain to IP if needed and get IP information
-		// Keep original domain/IP in database, only use resolved IP for getting geo info
-		_, ipInfo, err := utils.GetIPInfoFromDomainOrIP(modifyReq.IP)
+	if text := c.Query("name_template"); text != "" {
+		req.Options.NameTemplate, err = subscription.ParseNameTemplate(text)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, models.ApiResponse{
-				Status:  "error",
-				Message: fmt.Sprintf("Failed to resolve domain/IP or get IP info: %v", err),
-			})
-			return
+			return req, fmt.Errorf("invalid name_template: %v", err)
 		}
+	}
 
-		// Use original domain/IP address (not resolved IP)
-		setStatements = append(setStatements, fmt.Sprintf(" ip = $%d", paramIndex))
-		args = append(args, modifyReq.IP)
-		paramIndex++
+	req.Filter = c.Query("filter")
+	req.Group = c.Query("group")
+	return req, nil
+}
 
-		// Update geolocation info
-		setStatements = append(setStatements, fmt.Sprintf(" country_code = $%d", paramIndex))
-		args = append(args, ipInfo.CountryCode)
-		paramIndex++
+// tagFilters reads the tags and exclude_tags query parameters
+func tagFilters(c *gin.Context) ([][]string, []string, error) {
+	tags, err := models.ParseTagFilter(c.Query("tags"))
+	if err != nil {
+		return nil, nil, err
+	}
+	excludeTags, err := models.ParseTagList(c.Query("exclude_tags"))
+	if err != nil {
+		return nil, nil, err
+	}
+	return tags, excludeTags, nil
+}
 
-		setStatements = append(setStatements, fmt.Sprintf(" isp = $%d", paramIndex))
-		args = append(args, ipInfo.ISP)
-		paramIndex++
+// optionalBool parses a boolean query parameter, returning nil when unset
+func optionalBool(c *gin.Context, key string) (*bool, error) {
+	value, ok := c.GetQuery(key)
+	if !ok || value == "" {
+		return nil, nil
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s value: %s", key, value)
+	}
+	return &parsed, nil
+}
+
+// requestURL reconstructs the absolute URL of the current request
+func (h *Handlers) requestURL(c *gin.Context) string {
+	return h.requestOrigin(c) + c.Request.URL.RequestURI()
+}
 
-		setStatements = append(setStatements, fmt.Sprintf(" asn = $%d", paramIndex))
-		args = append(args, ipInfo.ASN)
-		paramIndex++
+// requestOrigin returns the configured public URL, or else the scheme and
+// host the current request was sent to. The X-Forwarded-Proto header is
+// only honored from trusted proxies, and only for http and https.
+func (h *Handlers) requestOrigin(c *gin.Context) string {
+	if h.PublicURL != "" {
+		return h.PublicURL
+	}
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if proto := strings.ToLower(c.GetHeader("X-Forwarded-Proto")); (proto == "http" || proto == "https") && h.fromTrustedProxy(c) {
+		scheme = proto
 	}
+	return fmt.Sprintf("%s://%s", scheme, c.Request.Host)
+}
 
-	// If no fields to update, return error
-	if len(setStatements) == 0 {
-		c.JSON(http.StatusBadRequest, models.ApiResponse{
-			Status:  "error",
-			Message: "No fields to update",
-		})
-		return
+// fromTrustedProxy reports whether the current request was sent by one of
+// the trusted proxies
+func (h *Handlers) fromTrustedProxy(c *gin.Context) bool {
+	ip := net.ParseIP(c.RemoteIP())
+	if ip == nil {
+		return false
 	}
+	for _, network := range h.TrustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
 
-	// Combine all set statements
-	query += strings.Join(setStatements, ",")
-	query += fmt.Sprintf(" WHERE node_id = $%d", paramIndex)
-	args = append(args, nodeID)
+// ModifyNodeByNodeID handles modifying a node by its NodeID
+func (h *Handlers) ModifyNodeByNodeID(c *gin.Context) {
+	nodeID := c.Param("id")
 
-	// Execute update
-	result, err := h.DB.Exec(query, args...)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ApiResponse{
-			Status:  "error",
-			Message: err.Error(),
-		})
+	var modifyReq models.ModifyRequest
+	if err := c.BindJSON(&modifyReq); err != nil {
+		respondError(c, http.StatusBadRequest, models.CodeBadRequest, err.Error())
 		return
 	}
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ApiResponse{
-			Status:  "error",
-			Message: err.Error(),
-		})
+	if err := h.Service.ModifyNodeByNodeID(nodeID, &modifyReq); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ApiResponse{
+		Status:  "success",
+		Message: "Node updated successfully",
+	})
+}
+
+// PatchEntry handles modifying the connection fields of a node while
+// keeping its node ID
+func (h *Handlers) PatchEntry(c *gin.Context) {
+	nodeID := c.Param("node_id")
+
+	var modifyReq models.ModifyRequest
+	if err := c.BindJSON(&modifyReq); err != nil {
+		respondError(c, http.StatusBadRequest, models.CodeBadRequest, err.Error())
 		return
 	}
 
-	if rowsAffected == 0 {
-		c.JSON(http.StatusNotFound, models.ApiResponse{
-			Status:  "error",
-			Message: "Node ID not found",
-		})
+	entry, err := h.Service.PatchEntry(nodeID, &modifyReq)
+	if err != nil {
+		writeError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, models.ApiResponse{
 		Status:  "success",
 		Message: "Node updated successfully",
+		Data:    entry,
 	})
 }
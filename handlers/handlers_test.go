@@ -0,0 +1,446 @@
+/*
+ * @Author: Vincent Yang
+ * @Date: 2026-10-17 06:48:12
+ * @LastEditors: Vincent Yang
+ * @LastEditTime: 2026-10-17 06:48:12
+ * @FilePath: /snell-panel/handlers/handlers_test.go
+ * @Telegram: https://t.me/missuo
+ * @GitHub: https://github.com/missuo
+ *
+ * Copyright © 2026 by Vincent, All Rights Reserved.
+ */
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"snell-panel/models"
+	"snell-panel/subscription"
+)
+
+// fakeService is a Service stub that returns canned values, or err when it
+// is set, so that the tests exercise routing, authentication, request
+// parsing and error mapping without a database
+type fakeService struct {
+	err error
+}
+
+var _ Service = (*fakeService)(nil)
+
+// fakeTokens maps the secrets accepted by fakeService to their tokens
+var fakeTokens = map[string]*models.Token{
+	"admin":     {ID: 1, Name: "admin", Scopes: []string{models.ScopeAdmin}},
+	"writer":    {ID: 2, Name: "writer", Scopes: []string{models.ScopeEntriesWrite}},
+	"reader":    {ID: 3, Name: "reader", Scopes: []string{models.ScopeEntriesRead}},
+	"subscribe": {ID: 4, Name: "subscribe", Scopes: []string{models.ScopeSubscribe}},
+}
+
+func fakeEntry() models.Entry {
+	return models.Entry{ID: 1, IP: "1.1.1.1", Port: 443, PSK: "secret", NodeID: "node-1", NodeName: "HK", Version: "4"}
+}
+
+func (f *fakeService) InsertEntry(entry *models.Entry) (*models.Entry, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	created := fakeEntry()
+	return &created, nil
+}
+
+func (f *fakeService) DeleteEntryByIP(ip string) error {
+	return f.err
+}
+
+func (f *fakeService) DeleteEntryByNodeID(nodeID string) error {
+	return f.err
+}
+
+func (f *fakeService) QueryEntries(query models.EntryQuery) (*models.EntryPage, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &models.EntryPage{Entries: []models.Entry{fakeEntry()}, Meta: models.PageMeta{Total: 1}}, nil
+}
+
+func (f *fakeService) GetEntry(nodeID string) (*models.Entry, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	entry := fakeEntry()
+	return &entry, nil
+}
+
+func (f *fakeService) GetResolutions(nodeID string) ([]models.Resolution, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return []models.Resolution{}, nil
+}
+
+func (f *fakeService) GetSubscription(req subscription.Request) (*subscription.Document, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &subscription.Document{ContentType: "text/plain; charset=utf-8", Body: []byte("HK = snell, 1.1.1.1, 443, psk = secret")}, nil
+}
+
+func (f *fakeService) ModifyNodeByNodeID(nodeID string, modifyReq *models.ModifyRequest) error {
+	return f.err
+}
+
+func (f *fakeService) PatchEntry(nodeID string, modifyReq *models.ModifyRequest) (*models.Entry, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	entry := fakeEntry()
+	return &entry, nil
+}
+
+func (f *fakeService) Authenticate(secret string) (*models.Token, error) {
+	token, ok := fakeTokens[secret]
+	if !ok {
+		return nil, models.ErrInvalidToken
+	}
+	return token, nil
+}
+
+func (f *fakeService) CreateToken(req *models.CreateTokenRequest) (*models.Token, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &models.Token{ID: 5, Name: req.Name, Scopes: req.Scopes, Token: "snp_new"}, nil
+}
+
+func (f *fakeService) ListTokens() ([]models.Token, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return []models.Token{*fakeTokens["admin"]}, nil
+}
+
+func (f *fakeService) RevokeToken(id int) error {
+	return f.err
+}
+
+func (f *fakeService) ListTags() ([]models.Tag, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return []models.Tag{{Name: "premium", Count: 1}}, nil
+}
+
+func (f *fakeService) TagEntries(req *models.TagRequest) error {
+	return f.err
+}
+
+func (f *fakeService) UntagEntries(req *models.TagRequest) error {
+	return f.err
+}
+
+func fakeSavedSubscription() *models.SavedSubscription {
+	return &models.SavedSubscription{ID: 1, Name: "family", Slug: "slug-1", Format: "surge"}
+}
+
+func (f *fakeService) CreateSavedSubscription(req *models.SavedSubscriptionRequest) (*models.SavedSubscription, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return fakeSavedSubscription(), nil
+}
+
+func (f *fakeService) ListSavedSubscriptions() ([]models.SavedSubscription, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return []models.SavedSubscription{*fakeSavedSubscription()}, nil
+}
+
+func (f *fakeService) GetSavedSubscription(id int) (*models.SavedSubscription, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return fakeSavedSubscription(), nil
+}
+
+func (f *fakeService) UpdateSavedSubscription(id int, req *models.SavedSubscriptionRequest) (*models.SavedSubscription, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return fakeSavedSubscription(), nil
+}
+
+func (f *fakeService) RotateSavedSubscription(id int) (*models.SavedSubscription, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return fakeSavedSubscription(), nil
+}
+
+func (f *fakeService) DeleteSavedSubscription(id int) error {
+	return f.err
+}
+
+func (f *fakeService) RenderSavedSubscription(slug string, profile subscription.ProfileOptions) (*subscription.Document, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &subscription.Document{ContentType: "text/plain; charset=utf-8", Body: []byte("HK = snell, 1.1.1.1, 443, psk = secret")}, nil
+}
+
+func (f *fakeService) RetryGeoLookups(ctx context.Context) error {
+	return f.err
+}
+
+func (f *fakeService) ProbeNodes(ctx context.Context) error {
+	return f.err
+}
+
+func (f *fakeService) ResolveDomains(ctx context.Context) error {
+	return f.err
+}
+
+var (
+	// errDatabase stands for an unexpected failure of the storage layer
+	errDatabase   = errors.New("database is down")
+	errValidation = &models.ValidationError{Fields: []models.FieldError{{Field: "port", Message: "must be between 1 and 65535"}}}
+	errConflict   = fmt.Errorf("%w: 1.1.1.1:443 is already used by another node", models.ErrConflict)
+)
+
+// routeTest is a request against the router and the response it expects
+type routeTest struct {
+	name   string
+	method string
+	path   string
+	// token is the API token sent with the request, if any
+	token string
+	body  string
+	// err is returned by every fakeService call
+	err        error
+	wantStatus int
+	// wantCode is the error code of a failed request
+	wantCode string
+}
+
+var routeTests = []routeTest{
+	{name: "welcome", method: http.MethodGet, path: "/", wantStatus: http.StatusOK},
+	{name: "unknown path", method: http.MethodGet, path: "/nope", wantStatus: http.StatusNotFound, wantCode: models.CodeNotFound},
+	{name: "insert entry", method: http.MethodPost, path: "/entry", token: "writer", body: `{"ip":"1.1.1.1","port":443,"psk":"secret"}`, wantStatus: http.StatusCreated},
+	{name: "insert entry without token", method: http.MethodPost, path: "/entry", body: `{"ip":"1.1.1.1","port":443,"psk":"secret"}`, wantStatus: http.StatusUnauthorized, wantCode: models.CodeUnauthorized},
+	{name: "insert entry with unknown token", method: http.MethodPost, path: "/entry", token: "bogus", body: `{"ip":"1.1.1.1","port":443,"psk":"secret"}`, wantStatus: http.StatusUnauthorized, wantCode: models.CodeUnauthorized},
+	{name: "insert entry with read scope", method: http.MethodPost, path: "/entry", token: "reader", body: `{"ip":"1.1.1.1","port":443,"psk":"secret"}`, wantStatus: http.StatusForbidden, wantCode: models.CodeForbidden},
+	{name: "insert entry with malformed json", method: http.MethodPost, path: "/entry", token: "writer", body: `{"ip":`, wantStatus: http.StatusBadRequest, wantCode: models.CodeBadRequest},
+	{name: "insert entry rejected by validation", method: http.MethodPost, path: "/entry", token: "writer", body: `{"ip":"1.1.1.1","port":443,"psk":"secret"}`, err: errValidation, wantStatus: http.StatusBadRequest, wantCode: models.CodeValidationFailed},
+	{name: "insert entry on a used address", method: http.MethodPost, path: "/entry", token: "writer", body: `{"ip":"1.1.1.1","port":443,"psk":"secret"}`, err: errConflict, wantStatus: http.StatusConflict, wantCode: models.CodeConflict},
+	{name: "insert entry with failing database", method: http.MethodPost, path: "/entry", token: "writer", body: `{"ip":"1.1.1.1","port":443,"psk":"secret"}`, err: errDatabase, wantStatus: http.StatusInternalServerError, wantCode: models.CodeInternalError},
+	{name: "list entries", method: http.MethodGet, path: "/entries", token: "reader", wantStatus: http.StatusOK},
+	{name: "list entries with subscribe scope", method: http.MethodGet, path: "/entries", token: "subscribe", wantStatus: http.StatusForbidden, wantCode: models.CodeForbidden},
+	{name: "list entries with query token", method: http.MethodGet, path: "/entries?token=reader", wantStatus: http.StatusUnauthorized, wantCode: models.CodeUnauthorized},
+	{name: "list entries with invalid limit", method: http.MethodGet, path: "/entries?limit=abc", token: "reader", wantStatus: http.StatusBadRequest, wantCode: models.CodeValidationFailed},
+	{name: "list entries with invalid asn", method: http.MethodGet, path: "/entries?asn=-1", token: "reader", wantStatus: http.StatusBadRequest, wantCode: models.CodeValidationFailed},
+	{name: "list entries with failing database", method: http.MethodGet, path: "/entries", token: "reader", err: errDatabase, wantStatus: http.StatusInternalServerError, wantCode: models.CodeInternalError},
+	{name: "delete entry by ip", method: http.MethodDelete, path: "/entry/1.1.1.1", token: "writer", wantStatus: http.StatusOK},
+	{name: "delete entry by ip without token", method: http.MethodDelete, path: "/entry/1.1.1.1", wantStatus: http.StatusUnauthorized, wantCode: models.CodeUnauthorized},
+	{name: "delete unknown ip", method: http.MethodDelete, path: "/entry/9.9.9.9", token: "writer", err: models.ErrNotFound, wantStatus: http.StatusNotFound, wantCode: models.CodeNotFound},
+	{name: "delete entry by node", method: http.MethodDelete, path: "/entry/node/node-1", token: "writer", wantStatus: http.StatusOK},
+	{name: "delete unknown node", method: http.MethodDelete, path: "/entry/node/missing", token: "writer", err: models.ErrNotFound, wantStatus: http.StatusNotFound, wantCode: models.CodeNotFound},
+	{name: "delete entry by node with read scope", method: http.MethodDelete, path: "/entry/node/node-1", token: "reader", wantStatus: http.StatusForbidden, wantCode: models.CodeForbidden},
+	{name: "get entry", method: http.MethodGet, path: "/entry/node/node-1", token: "reader", wantStatus: http.StatusOK},
+	{name: "get entry without token", method: http.MethodGet, path: "/entry/node/node-1", wantStatus: http.StatusUnauthorized, wantCode: models.CodeUnauthorized},
+	{name: "get unknown entry", method: http.MethodGet, path: "/entry/node/missing", token: "reader", err: models.ErrNotFound, wantStatus: http.StatusNotFound, wantCode: models.CodeNotFound},
+	{name: "get resolutions", method: http.MethodGet, path: "/entry/node/node-1/resolutions", token: "reader", wantStatus: http.StatusOK},
+	{name: "get resolutions of unknown node", method: http.MethodGet, path: "/entry/node/missing/resolutions", token: "reader", err: models.ErrNotFound, wantStatus: http.StatusNotFound, wantCode: models.CodeNotFound},
+	{name: "patch entry", method: http.MethodPatch, path: "/entry/node/node-1", token: "writer", body: `{"port":8443}`, wantStatus: http.StatusOK},
+	{name: "patch entry with malformed json", method: http.MethodPatch, path: "/entry/node/node-1", token: "writer", body: `[`, wantStatus: http.StatusBadRequest, wantCode: models.CodeBadRequest},
+	{name: "patch entry without fields", method: http.MethodPatch, path: "/entry/node/node-1", token: "writer", body: `{}`, err: models.ErrNoFieldsToUpdate, wantStatus: http.StatusBadRequest, wantCode: models.CodeValidationFailed},
+	{name: "patch entry rejected by validation", method: http.MethodPatch, path: "/entry/node/node-1", token: "writer", body: `{"port":0}`, err: errValidation, wantStatus: http.StatusBadRequest, wantCode: models.CodeValidationFailed},
+	{name: "patch unknown entry", method: http.MethodPatch, path: "/entry/node/missing", token: "writer", body: `{"port":8443}`, err: models.ErrNotFound, wantStatus: http.StatusNotFound, wantCode: models.CodeNotFound},
+	{name: "patch entry onto a used address", method: http.MethodPatch, path: "/entry/node/node-1", token: "writer", body: `{"port":443}`, err: errConflict, wantStatus: http.StatusConflict, wantCode: models.CodeConflict},
+	{name: "modify node", method: http.MethodPut, path: "/modify/node-1", token: "writer", body: `{"node_name":"HK 2"}`, wantStatus: http.StatusOK},
+	{name: "modify node with malformed json", method: http.MethodPut, path: "/modify/node-1", token: "writer", body: `{`, wantStatus: http.StatusBadRequest, wantCode: models.CodeBadRequest},
+	{name: "modify node without fields", method: http.MethodPut, path: "/modify/node-1", token: "writer", body: `{}`, err: models.ErrNoFieldsToUpdate, wantStatus: http.StatusBadRequest, wantCode: models.CodeValidationFailed},
+	{name: "modify unknown node", method: http.MethodPut, path: "/modify/missing", token: "writer", body: `{"node_name":"HK 2"}`, err: models.ErrNotFound, wantStatus: http.StatusNotFound, wantCode: models.CodeNotFound},
+	{name: "modify node with read scope", method: http.MethodPut, path: "/modify/node-1", token: "reader", body: `{"node_name":"HK 2"}`, wantStatus: http.StatusForbidden, wantCode: models.CodeForbidden},
+	{name: "subscribe", method: http.MethodGet, path: "/subscribe", token: "subscribe", wantStatus: http.StatusOK},
+	{name: "subscribe with query token", method: http.MethodGet, path: "/subscribe?token=subscribe", wantStatus: http.StatusOK},
+	{name: "subscribe without token", method: http.MethodGet, path: "/subscribe", wantStatus: http.StatusUnauthorized, wantCode: models.CodeUnauthorized},
+	{name: "subscribe to a surge profile", method: http.MethodGet, path: "/subscribe?format=surge-profile", token: "subscribe", wantStatus: http.StatusOK},
+	{name: "subscribe with unsupported format", method: http.MethodGet, path: "/subscribe?format=nope", token: "subscribe", wantStatus: http.StatusBadRequest, wantCode: models.CodeValidationFailed},
+	{name: "subscribe with invalid healthy_only", method: http.MethodGet, path: "/subscribe?healthy_only=maybe", token: "subscribe", wantStatus: http.StatusBadRequest, wantCode: models.CodeValidationFailed},
+	{name: "subscribe with invalid ip_version", method: http.MethodGet, path: "/subscribe?ip_version=5", token: "subscribe", wantStatus: http.StatusBadRequest, wantCode: models.CodeValidationFailed},
+	{name: "subscribe with invalid tag filter", method: http.MethodGet, path: "/subscribe?tags=bad!", token: "subscribe", wantStatus: http.StatusBadRequest, wantCode: models.CodeValidationFailed},
+	{name: "subscribe with invalid include pattern", method: http.MethodGet, path: "/subscribe?include=(", token: "subscribe", wantStatus: http.StatusBadRequest, wantCode: models.CodeValidationFailed},
+	{name: "subscribe with invalid rename rule", method: http.MethodGet, path: "/subscribe?rename=HK", token: "subscribe", wantStatus: http.StatusBadRequest, wantCode: models.CodeValidationFailed},
+	{name: "subscribe with invalid name template", method: http.MethodGet, path: "/subscribe?name_template=%7B%7B", token: "subscribe", wantStatus: http.StatusBadRequest, wantCode: models.CodeValidationFailed},
+	{name: "subscribe without entries", method: http.MethodGet, path: "/subscribe", token: "subscribe", err: models.ErrNoEntries, wantStatus: http.StatusNotFound, wantCode: models.CodeNotFound},
+	{name: "profile", method: http.MethodGet, path: "/profile", token: "subscribe", wantStatus: http.StatusOK},
+	{name: "profile without token", method: http.MethodGet, path: "/profile", wantStatus: http.StatusUnauthorized, wantCode: models.CodeUnauthorized},
+	{name: "profile with invalid interval", method: http.MethodGet, path: "/profile?interval=0", token: "subscribe", wantStatus: http.StatusBadRequest, wantCode: models.CodeValidationFailed},
+	{name: "profile with invalid healthy_only", method: http.MethodGet, path: "/profile?healthy_only=maybe", token: "subscribe", wantStatus: http.StatusBadRequest, wantCode: models.CodeValidationFailed},
+	{name: "profile without entries", method: http.MethodGet, path: "/profile", token: "subscribe", err: models.ErrNoEntries, wantStatus: http.StatusNotFound, wantCode: models.CodeNotFound},
+	{name: "list tags", method: http.MethodGet, path: "/tags", token: "reader", wantStatus: http.StatusOK},
+	{name: "list tags without token", method: http.MethodGet, path: "/tags", wantStatus: http.StatusUnauthorized, wantCode: models.CodeUnauthorized},
+	{name: "assign tags", method: http.MethodPost, path: "/tags/assign", token: "writer", body: `{"node_ids":["node-1"],"tags":["fast"]}`, wantStatus: http.StatusOK},
+	{name: "assign tags without node ids", method: http.MethodPost, path: "/tags/assign", token: "writer", body: `{"tags":["fast"]}`, wantStatus: http.StatusBadRequest, wantCode: models.CodeBadRequest},
+	{name: "assign invalid tags", method: http.MethodPost, path: "/tags/assign", token: "writer", body: `{"node_ids":["node-1"],"tags":["bad!"]}`, err: errValidation, wantStatus: http.StatusBadRequest, wantCode: models.CodeValidationFailed},
+	{name: "assign tags to unknown node", method: http.MethodPost, path: "/tags/assign", token: "writer", body: `{"node_ids":["missing"],"tags":["fast"]}`, err: models.ErrNotFound, wantStatus: http.StatusNotFound, wantCode: models.CodeNotFound},
+	{name: "unassign tags", method: http.MethodPost, path: "/tags/unassign", token: "writer", body: `{"node_ids":["node-1"],"tags":["fast"]}`, wantStatus: http.StatusOK},
+	{name: "unassign tags with read scope", method: http.MethodPost, path: "/tags/unassign", token: "reader", body: `{"node_ids":["node-1"],"tags":["fast"]}`, wantStatus: http.StatusForbidden, wantCode: models.CodeForbidden},
+	{name: "create subscription", method: http.MethodPost, path: "/subscriptions", token: "admin", body: `{"name":"family"}`, wantStatus: http.StatusCreated},
+	{name: "create subscription with write scope", method: http.MethodPost, path: "/subscriptions", token: "writer", body: `{"name":"family"}`, wantStatus: http.StatusForbidden, wantCode: models.CodeForbidden},
+	{name: "create subscription with malformed json", method: http.MethodPost, path: "/subscriptions", token: "admin", body: `{`, wantStatus: http.StatusBadRequest, wantCode: models.CodeBadRequest},
+	{name: "create subscription rejected by validation", method: http.MethodPost, path: "/subscriptions", token: "admin", body: `{"name":"family"}`, err: errValidation, wantStatus: http.StatusBadRequest, wantCode: models.CodeValidationFailed},
+	{name: "list subscriptions", method: http.MethodGet, path: "/subscriptions", token: "admin", wantStatus: http.StatusOK},
+	{name: "get subscription", method: http.MethodGet, path: "/subscriptions/1", token: "admin", wantStatus: http.StatusOK},
+	{name: "get subscription with invalid id", method: http.MethodGet, path: "/subscriptions/abc", token: "admin", wantStatus: http.StatusBadRequest, wantCode: models.CodeValidationFailed},
+	{name: "get unknown subscription", method: http.MethodGet, path: "/subscriptions/9", token: "admin", err: models.ErrSubscriptionNotFound, wantStatus: http.StatusNotFound, wantCode: models.CodeNotFound},
+	{name: "update subscription", method: http.MethodPut, path: "/subscriptions/1", token: "admin", body: `{"name":"family"}`, wantStatus: http.StatusOK},
+	{name: "update unknown subscription", method: http.MethodPut, path: "/subscriptions/9", token: "admin", body: `{"name":"family"}`, err: models.ErrSubscriptionNotFound, wantStatus: http.StatusNotFound, wantCode: models.CodeNotFound},
+	{name: "rotate subscription", method: http.MethodPost, path: "/subscriptions/1/rotate", token: "admin", wantStatus: http.StatusOK},
+	{name: "rotate unknown subscription", method: http.MethodPost, path: "/subscriptions/9/rotate", token: "admin", err: models.ErrSubscriptionNotFound, wantStatus: http.StatusNotFound, wantCode: models.CodeNotFound},
+	{name: "delete subscription", method: http.MethodDelete, path: "/subscriptions/1", token: "admin", wantStatus: http.StatusOK},
+	{name: "delete subscription without token", method: http.MethodDelete, path: "/subscriptions/1", wantStatus: http.StatusUnauthorized, wantCode: models.CodeUnauthorized},
+	{name: "shared subscription", method: http.MethodGet, path: "/sub/slug-1", wantStatus: http.StatusOK},
+	{name: "unknown shared subscription", method: http.MethodGet, path: "/sub/missing", err: models.ErrSubscriptionNotFound, wantStatus: http.StatusNotFound, wantCode: models.CodeNotFound},
+	{name: "create token", method: http.MethodPost, path: "/tokens", token: "admin", body: `{"name":"ci","scopes":["entries:read"]}`, wantStatus: http.StatusCreated},
+	{name: "create token with write scope", method: http.MethodPost, path: "/tokens", token: "writer", body: `{"name":"ci","scopes":["entries:read"]}`, wantStatus: http.StatusForbidden, wantCode: models.CodeForbidden},
+	{name: "create token with malformed json", method: http.MethodPost, path: "/tokens", token: "admin", body: `{`, wantStatus: http.StatusBadRequest, wantCode: models.CodeBadRequest},
+	{name: "create token rejected by validation", method: http.MethodPost, path: "/tokens", token: "admin", body: `{"scopes":["root"]}`, err: errValidation, wantStatus: http.StatusBadRequest, wantCode: models.CodeValidationFailed},
+	{name: "list tokens", method: http.MethodGet, path: "/tokens", token: "admin", wantStatus: http.StatusOK},
+	{name: "revoke token", method: http.MethodDelete, path: "/tokens/2", token: "admin", wantStatus: http.StatusOK},
+	{name: "revoke token with invalid id", method: http.MethodDelete, path: "/tokens/abc", token: "admin", wantStatus: http.StatusBadRequest, wantCode: models.CodeValidationFailed},
+	{name: "revoke unknown token", method: http.MethodDelete, path: "/tokens/9", token: "admin", err: models.ErrTokenNotFound, wantStatus: http.StatusNotFound, wantCode: models.CodeNotFound},
+	{name: "retry geo lookups", method: http.MethodGet, path: "/cron/geo", token: "writer", wantStatus: http.StatusOK},
+	{name: "retry geo lookups with a read token", method: http.MethodGet, path: "/cron/geo", token: "reader", wantStatus: http.StatusForbidden, wantCode: models.CodeForbidden},
+	{name: "probe nodes", method: http.MethodGet, path: "/cron/probe", token: "writer", wantStatus: http.StatusOK},
+	{name: "probe nodes with a database error", method: http.MethodGet, path: "/cron/probe", token: "writer", err: errDatabase, wantStatus: http.StatusInternalServerError, wantCode: models.CodeInternalError},
+	{name: "resolve domains", method: http.MethodGet, path: "/cron/resolve", token: "writer", wantStatus: http.StatusOK},
+	{name: "resolve domains without a token", method: http.MethodGet, path: "/cron/resolve", wantStatus: http.StatusUnauthorized, wantCode: models.CodeUnauthorized},
+	{name: "retry geo lookups with a database error", method: http.MethodGet, path: "/cron/geo", token: "writer", err: errDatabase, wantStatus: http.StatusInternalServerError, wantCode: models.CodeInternalError},
+}
+
+// newTestRouter returns a router serving every route with a fakeService
+// that fails with err. Each request records its route in covered.
+func newTestRouter(err error, covered map[string]bool) *gin.Engine {
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		covered[c.Request.Method+" "+c.FullPath()] = true
+	})
+	svc := &fakeService{err: err}
+	NewHandlers(svc).RegisterRoutes(r)
+	return r
+}
+
+func TestRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	covered := make(map[string]bool)
+	for _, tt := range routeTests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			newTestRouter(tt.err, covered).ServeHTTP(w, newTestRequest(tt))
+			checkResponse(t, tt, w)
+		})
+	}
+
+	for _, route := range newTestRouter(nil, covered).Routes() {
+		if !covered[route.Method+" "+route.Path] {
+			t.Errorf("route %s %s has no test case", route.Method, route.Path)
+		}
+	}
+}
+
+func newTestRequest(tt routeTest) *http.Request {
+	req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+	if tt.body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if tt.token != "" {
+		req.Header.Set("Authorization", "Bearer "+tt.token)
+	}
+	return req
+}
+
+func checkResponse(t *testing.T, tt routeTest, w *httptest.ResponseRecorder) {
+	t.Helper()
+	if w.Code != tt.wantStatus {
+		t.Fatalf("status = %d, want %d, body %s", w.Code, tt.wantStatus, w.Body)
+	}
+	if w.Code < http.StatusBadRequest {
+		return
+	}
+	var resp models.ApiResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decoding error response: %v", err)
+	}
+	if resp.Status != "error" {
+		t.Errorf("status field = %q, want %q", resp.Status, "error")
+	}
+	if resp.Code != tt.wantCode {
+		t.Errorf("code = %q, want %q", resp.Code, tt.wantCode)
+	}
+}
+
+func TestRequestOrigin(t *testing.T) {
+	_, proxy, _ := net.ParseCIDR("10.0.0.0/8")
+
+	tests := []struct {
+		name       string
+		publicURL  string
+		remoteAddr string
+		proto      string
+		want       string
+	}{
+		{name: "plain request", remoteAddr: "203.0.113.7:5000", want: "http://panel.example.com"},
+		{name: "trusted proxy", remoteAddr: "10.0.0.2:5000", proto: "https", want: "https://panel.example.com"},
+		{name: "untrusted client", remoteAddr: "203.0.113.7:5000", proto: "https", want: "http://panel.example.com"},
+		{name: "unknown scheme", remoteAddr: "10.0.0.2:5000", proto: "javascript", want: "http://panel.example.com"},
+		{name: "public url", publicURL: "https://sub.example.com", remoteAddr: "10.0.0.2:5000", proto: "http", want: "https://sub.example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Handlers{PublicURL: tt.publicURL, TrustedProxies: []*net.IPNet{proxy}}
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodGet, "http://panel.example.com/profile", nil)
+			c.Request.RemoteAddr = tt.remoteAddr
+			if tt.proto != "" {
+				c.Request.Header.Set("X-Forwarded-Proto", tt.proto)
+			}
+			if got := h.requestOrigin(c); got != tt.want {
+				t.Errorf("requestOrigin() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSubscriptionRequestErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{query: "format=quantumult", want: "unsupported subscription format: quantumult"},
+		{query: "healthy_only=maybe", want: "invalid healthy_only value: maybe"},
+		{query: "ip_version=5", want: "invalid ip_version value: 5"},
+		{query: "exclude=(", want: "invalid rule: exclude: "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodGet, "/subscribe?"+tt.query, nil)
+			_, err := parseSubscriptionRequest(c)
+			if err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+				t.Errorf("parseSubscriptionRequest() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+/*
+ * @Author: Vincent Yang
+ * @Date: 2026-10-18 01:05:48
+ * @LastEditors: Vincent Yang
+ * @LastEditTime: 2026-10-18 01:05:48
+ * @FilePath: /snell-panel/handlers/subscriptions.go
+ * @Telegram: https://t.me/missuo
+ * @GitHub: https://github.com/missuo
+ *
+ * Copyright © 2026 by Vincent, All Rights Reserved.
+ */
+
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"snell-panel/models"
+	"snell-panel/subscription"
+)
+
+// withURL fills in the absolute URL of a saved subscription
+func (h *Handlers) withURL(c *gin.Context, sub *models.SavedSubscription) *models.SavedSubscription {
+	sub.URL = h.requestOrigin(c) + "/sub/" + sub.Slug
+	return sub
+}
+
+// subscriptionID parses the saved subscription ID path parameter,
+// responding with an error if it is invalid
+func subscriptionID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, models.CodeValidationFailed, "Invalid subscription ID")
+		return 0, false
+	}
+	return id, true
+}
+
+// CreateSavedSubscription handles storing a new saved subscription
+func (h *Handlers) CreateSavedSubscription(c *gin.Context) {
+	var req models.SavedSubscriptionRequest
+	if err := c.BindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, models.CodeBadRequest, err.Error())
+		return
+	}
+
+	sub, err := h.Service.CreateSavedSubscription(&req)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.ApiResponse{
+		Status:  "success",
+		Message: "Subscription created successfully",
+		Data:    h.withURL(c, sub),
+	})
+}
+
+// ListSavedSubscriptions handles retrieving every saved subscription
+func (h *Handlers) ListSavedSubscriptions(c *gin.Context) {
+	subs, err := h.Service.ListSavedSubscriptions()
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	if subs == nil {
+		subs = []models.SavedSubscription{}
+	}
+	for i := range subs {
+		h.withURL(c, &subs[i])
+	}
+
+	c.JSON(http.StatusOK, models.ApiResponse{
+		Status:  "success",
+		Message: "Subscriptions retrieved successfully",
+		Data:    subs,
+	})
+}
+
+// GetSavedSubscription handles retrieving a saved subscription by ID
+func (h *Handlers) GetSavedSubscription(c *gin.Context) {
+	id, ok := subscriptionID(c)
+	if !ok {
+		return
+	}
+
+	sub, err := h.Service.GetSavedSubscription(id)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ApiResponse{
+		Status:  "success",
+		Message: "Subscription retrieved successfully",
+		Data:    h.withURL(c, sub),
+	})
+}
+
+// UpdateSavedSubscription handles replacing the settings of a saved subscription
+func (h *Handlers) UpdateSavedSubscription(c *gin.Context) {
+	id, ok := subscriptionID(c)
+	if !ok {
+		return
+	}
+
+	var req models.SavedSubscriptionRequest
+	if err := c.BindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, models.CodeBadRequest, err.Error())
+		return
+	}
+
+	sub, err := h.Service.UpdateSavedSubscription(id, &req)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ApiResponse{
+		Status:  "success",
+		Message: "Subscription updated successfully",
+		Data:    h.withURL(c, sub),
+	})
+}
+
+// RotateSavedSubscription handles replacing the URL of a saved subscription
+func (h *Handlers) RotateSavedSubscription(c *gin.Context) {
+	id, ok := subscriptionID(c)
+	if !ok {
+		return
+	}
+
+	sub, err := h.Service.RotateSavedSubscription(id)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ApiResponse{
+		Status:  "success",
+		Message: "Subscription URL rotated successfully, the previous URL no longer works",
+		Data:    h.withURL(c, sub),
+	})
+}
+
+// DeleteSavedSubscription handles deleting a saved subscription by ID
+func (h *Handlers) DeleteSavedSubscription(c *gin.Context) {
+	id, ok := subscriptionID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.Service.DeleteSavedSubscription(id); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ApiResponse{
+		Status:  "success",
+		Message: "Subscription deleted successfully",
+	})
+}
+
+// GetSharedSubscription handles serving a saved subscription by slug.
+// The slug authenticates the request, so no API token is needed.
+func (h *Handlers) GetSharedSubscription(c *gin.Context) {
+	doc, err := h.Service.RenderSavedSubscription(c.Param("slug"), subscription.ProfileOptions{
+		URL:      h.requestURL(c),
+		Interval: subscription.DefaultProfileInterval,
+	})
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.Data(http.StatusOK, doc.ContentType, doc.Body)
+}
@@ -0,0 +1,78 @@
+/*
+ * @Author: Vincent Yang
+ * @Date: 2026-10-17 23:47:35
+ * @LastEditors: Vincent Yang
+ * @LastEditTime: 2026-10-17 23:47:35
+ * @FilePath: /snell-panel/handlers/tags.go
+ * @Telegram: https://t.me/missuo
+ * @GitHub: https://github.com/missuo
+ *
+ * Copyright © 2026 by Vincent, All Rights Reserved.
+ */
+
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"snell-panel/models"
+)
+
+// ListTags handles listing every tag in use
+func (h *Handlers) ListTags(c *gin.Context) {
+	tags, err := h.Service.ListTags()
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	if tags == nil {
+		tags = []models.Tag{}
+	}
+
+	c.JSON(http.StatusOK, models.ApiResponse{
+		Status:  "success",
+		Message: "Tags retrieved successfully",
+		Data:    tags,
+	})
+}
+
+// TagEntries handles adding tags to several nodes at once
+func (h *Handlers) TagEntries(c *gin.Context) {
+	var req models.TagRequest
+	if err := c.BindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, models.CodeBadRequest, err.Error())
+		return
+	}
+
+	if err := h.Service.TagEntries(&req); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ApiResponse{
+		Status:  "success",
+		Message: "Nodes tagged successfully",
+	})
+}
+
+// UntagEntries handles removing tags from several nodes at once
+func (h *Handlers) UntagEntries(c *gin.Context) {
+	var req models.TagRequest
+	if err := c.BindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, models.CodeBadRequest, err.Error())
+		return
+	}
+
+	if err := h.Service.UntagEntries(&req); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ApiResponse{
+		Status:  "success",
+		Message: "Nodes untagged successfully",
+	})
+}
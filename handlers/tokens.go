@@ -0,0 +1,81 @@
+/*
+ * @Author: Vincent Yang
+ * @Date: 2026-10-17 16:45:20
+ * @LastEditors: Vincent Yang
+ * @LastEditTime: 2026-10-17 16:45:20
+ * @FilePath: /snell-panel/handlers/tokens.go
+ * @Telegram: https://t.me/missuo
+ * @GitHub: https://github.com/missuo
+ *
+ * Copyright © 2026 by Vincent, All Rights Reserved.
+ */
+
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"snell-panel/models"
+)
+
+// CreateToken handles minting a new API token
+func (h *Handlers) CreateToken(c *gin.Context) {
+	var req models.CreateTokenRequest
+	if err := c.BindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, models.CodeBadRequest, err.Error())
+		return
+	}
+
+	token, err := h.Service.CreateToken(&req)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.ApiResponse{
+		Status:  "success",
+		Message: "Token created successfully, store it now as it cannot be retrieved again",
+		Data:    token,
+	})
+}
+
+// ListTokens handles retrieving all API tokens
+func (h *Handlers) ListTokens(c *gin.Context) {
+	tokens, err := h.Service.ListTokens()
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	if tokens == nil {
+		tokens = []models.Token{}
+	}
+
+	c.JSON(http.StatusOK, models.ApiResponse{
+		Status:  "success",
+		Message: "Tokens retrieved successfully",
+		Data:    tokens,
+	})
+}
+
+// RevokeToken handles revoking an API token by ID
+func (h *Handlers) RevokeToken(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, models.CodeValidationFailed, "Invalid token ID")
+		return
+	}
+
+	if err := h.Service.RevokeToken(id); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ApiResponse{
+		Status:  "success",
+		Message: "Token revoked successfully",
+	})
+}
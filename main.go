@@ -13,23 +13,40 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"os"
+	"strconv"
 
 	"snell-panel/config"
 	"snell-panel/database"
 	"snell-panel/service"
 )
 
+const migrateUsage = "Usage: snell-panel migrate {up|down [steps]|status}"
+
 func main() {
 	// Load configuration
 	cfg := config.LoadConfig()
 
-	// Initialize database
-	db := database.InitDB(cfg.DatabaseURL)
-	defer database.CloseDB(db)
+	// Run the migrate subcommand instead of the server if requested
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(cfg, os.Args[2:])
+		return
+	}
+
+	// Initialize service and database
+	svc := service.NewService(cfg)
+	defer svc.Close()
+
+	// Start background jobs such as node health probing
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	svc.StartWorkers(ctx)
 
 	// Initialize router
-	router := service.Router(cfg)
+	router := service.Router(svc)
 
 	// Start server
 	log.Printf("Server starting on port %d...", cfg.Port)
@@ -37,3 +54,64 @@ func main() {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 }
+
+// runMigrate handles the migrate up, down and status subcommands
+func runMigrate(cfg *config.Config, args []string) {
+	if len(args) == 0 {
+		log.Fatal(migrateUsage)
+	}
+
+	db, driver, err := database.Open(cfg.DatabaseURL)
+	if err != nil {
+		log.Fatalf("Failed to connect to %s database: %v", driver, err)
+	}
+	defer db.Close()
+
+	migrator := database.NewMigrator(db, driver)
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up()
+		for _, migration := range applied {
+			fmt.Printf("Applied %d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		if len(applied) == 0 {
+			fmt.Println("Database is up to date")
+		}
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				log.Fatalf("Invalid number of steps: %s", args[1])
+			}
+		}
+		rolledBack, err := migrator.Down(steps)
+		for _, migration := range rolledBack {
+			fmt.Printf("Rolled back %d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			log.Fatalf("Rollback failed: %v", err)
+		}
+		if len(rolledBack) == 0 {
+			fmt.Println("No migrations to roll back")
+		}
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			log.Fatalf("Failed to read migration status: %v", err)
+		}
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%4d  %-40s %s\n", status.Version, status.Name, appliedAt)
+		}
+	default:
+		log.Fatal(migrateUsage)
+	}
+}
@@ -0,0 +1,79 @@
+/*
+ * @Author: Vincent Yang
+ * @Date: 2026-10-17 14:26:33
+ * @LastEditors: Vincent Yang
+ * @LastEditTime: 2026-10-17 14:26:33
+ * @FilePath: /snell-panel/models/errors.go
+ * @Telegram: https://t.me/missuo
+ * @GitHub: https://github.com/missuo
+ *
+ * Copyright © 2026 by Vincent, All Rights Reserved.
+ */
+
+package models
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	// ErrNotFound is returned when no entry matches the given key
+	ErrNotFound = errors.New("entry not found")
+	// ErrNoEntries is returned when a subscription would contain no nodes
+	ErrNoEntries = errors.New("no entries found")
+	// ErrNoFieldsToUpdate is returned when a modify request changes nothing
+	ErrNoFieldsToUpdate = errors.New("no fields to update")
+	// ErrInvalidRequest is wrapped by errors caused by invalid client input
+	ErrInvalidRequest = errors.New("invalid request")
+	// ErrTokenNotFound is returned when no token matches the given key
+	ErrTokenNotFound = errors.New("token not found")
+	// ErrSubscriptionNotFound is returned when no saved subscription
+	// matches the given key
+	ErrSubscriptionNotFound = errors.New("subscription not found")
+	// ErrInvalidToken is returned when a token is unknown or expired
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrConflict is wrapped by errors caused by a clash with existing data
+	ErrConflict = errors.New("conflict")
+	// ErrGeoLookupFailed is wrapped by errors of geolocation lookups
+	ErrGeoLookupFailed = errors.New("geolocation lookup failed")
+)
+
+// Error codes reported in ApiResponse.Code. They are part of the API and
+// must never change.
+const (
+	CodeBadRequest       = "bad_request"
+	CodeValidationFailed = "validation_failed"
+	CodeNotFound         = "not_found"
+	CodeConflict         = "conflict"
+	CodeGeoLookupFailed  = "geo_lookup_failed"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeInternalError    = "internal_error"
+)
+
+// FieldError describes why the value of a single request field is invalid
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError is returned when one or more request fields are
+// invalid. It wraps ErrInvalidRequest.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+// Error joins the field errors into a single message
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		messages[i] = field.Field + " " + field.Message
+	}
+	return "validation failed: " + strings.Join(messages, "; ")
+}
+
+// Unwrap makes errors.Is(err, ErrInvalidRequest) hold for validation errors
+func (e *ValidationError) Unwrap() error {
+	return ErrInvalidRequest
+}
@@ -12,10 +12,46 @@
 
 package models
 
+import (
+	"net"
+	"strings"
+	"time"
+)
+
+// Node health statuses reported by the prober
+const (
+	// NodeStatusUnknown means the node has not been probed yet
+	NodeStatusUnknown = "unknown"
+	// NodeStatusUp means the last probe connected successfully
+	NodeStatusUp = "up"
+	// NodeStatusDown means the last probe failed to connect
+	NodeStatusDown = "down"
+)
+
+// Snell obfuscation modes
+const (
+	ObfsHTTP = "http"
+	ObfsTLS  = "tls"
+)
+
+// Geolocation enrichment states of an entry
+const (
+	// GeoStatusPending means the lookup failed and will be retried
+	GeoStatusPending = "pending"
+	// GeoStatusResolved means country, ISP and ASN are filled in
+	GeoStatusResolved = "resolved"
+	// GeoStatusFailed means the lookup was retried too many times and given up
+	GeoStatusFailed = "failed"
+)
+
 // Entry represents a snell proxy entry
 type Entry struct {
-	ID          int    `json:"id"`
-	IP          string `json:"ip"`
+	ID int    `json:"id"`
+	IP string `json:"ip"`
+	// IPv4 and IPv6 are the addresses of the node in each IP family,
+	// detected from IP or supplied by the client
+	IPv4        string `json:"ipv4,omitempty"`
+	IPv6        string `json:"ipv6,omitempty"`
 	Port        int    `json:"port"`
 	PSK         string `json:"psk"`
 	CountryCode string `json:"country_code"`
@@ -24,12 +60,276 @@ type Entry struct {
 	NodeID      string `json:"node_id"`
 	NodeName    string `json:"node_name"`
 	Version     string `json:"version"`
+	// Obfs is the snell obfuscation mode and ObfsHost the host it
+	// impersonates
+	Obfs     string `json:"obfs,omitempty"`
+	ObfsHost string `json:"obfs_host,omitempty"`
+	// ShadowTLSPassword, ShadowTLSSNI and ShadowTLSVersion describe a
+	// ShadowTLS server fronting the node on ShadowTLSPort, or on Port
+	// when ShadowTLSPort is 0
+	ShadowTLSPassword string `json:"shadow_tls_password,omitempty"`
+	ShadowTLSSNI      string `json:"shadow_tls_sni,omitempty"`
+	ShadowTLSVersion  int    `json:"shadow_tls_version,omitempty"`
+	ShadowTLSPort     int    `json:"shadow_tls_port,omitempty"`
+	// TFO enables TCP Fast Open and Reuse connection reuse in clients
+	TFO   bool `json:"tfo,omitempty"`
+	Reuse bool `json:"reuse,omitempty"`
+	// RelayNodeID is the node this node is dialed through, and
+	// RelayPolicy the client policy it is dialed through otherwise
+	RelayNodeID string     `json:"relay_node_id,omitempty"`
+	RelayPolicy string     `json:"relay_policy,omitempty"`
+	Status      string     `json:"status"`
+	LatencyMs   *int       `json:"latency_ms"`
+	LastSeen    *time.Time `json:"last_seen"`
+	// FailingSince is when the current run of failed probes started
+	FailingSince *time.Time `json:"failing_since,omitempty"`
+	// LastError is the error of the latest failed probe
+	LastError string `json:"last_error,omitempty"`
+	// ExcludedReason explains why the node is left out of healthy-only subscriptions
+	ExcludedReason string `json:"excluded_reason,omitempty"`
+	// IPv6CountryCode, IPv6ISP and IPv6ASN geolocate the IPv6 address,
+	// the fields above geolocate the IPv4 address when there is one
+	IPv6CountryCode string `json:"ipv6_country_code,omitempty"`
+	IPv6ISP         string `json:"ipv6_isp,omitempty"`
+	IPv6ASN         int    `json:"ipv6_asn,omitempty"`
+	// GeoStatus is the state of the country, ISP and ASN lookup
+	GeoStatus string `json:"geo_status"`
+	// GeoError is the error of the latest failed lookup
+	GeoError string `json:"geo_error,omitempty"`
+	// GeoAttempts counts the failed lookups since the address was set
+	GeoAttempts int `json:"geo_attempts,omitempty"`
+	// GeoRetryAt is when a pending lookup is retried next
+	GeoRetryAt *time.Time `json:"geo_retry_at,omitempty"`
+	// ResolvedIPs are the addresses a domain entry resolved to last time
+	ResolvedIPs []string `json:"resolved_ips,omitempty"`
+	// ResolvedAt is when a domain entry was last resolved
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+	// ResolveError is the error of the latest failed resolution
+	ResolveError string `json:"resolve_error,omitempty"`
+	// UnresolvableSince is when a domain entry stopped resolving
+	UnresolvableSince *time.Time `json:"unresolvable_since,omitempty"`
+	// Tags label the node for tag-based selection
+	Tags []string `json:"tags"`
+	// CreatedAt is when the node was registered
+	CreatedAt time.Time `json:"created_at"`
+	// UpdatedAt is when the node was last edited or geolocated
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SetGeoIP fills in the geolocation information of the preferred
+// address of the entry
+func (e *Entry) SetGeoIP(geoIP GeoIP) {
+	e.CountryCode = geoIP.CountryCode
+	e.ISP = geoIP.ISP
+	e.ASN = geoIP.ASN
+	e.GeoStatus = GeoStatusResolved
+	e.GeoError = ""
+	e.GeoAttempts = 0
+	e.GeoRetryAt = nil
+}
+
+// SetIPv6GeoIP fills in the geolocation information of the IPv6 address
+func (e *Entry) SetIPv6GeoIP(geoIP GeoIP) {
+	e.IPv6CountryCode = geoIP.CountryCode
+	e.IPv6ISP = geoIP.ISP
+	e.IPv6ASN = geoIP.ASN
+}
+
+// SetGeoPending clears the geolocation information of the entry and
+// queues the lookup to be retried at the given time
+func (e *Entry) SetGeoPending(err error, retryAt time.Time) {
+	e.CountryCode = ""
+	e.ISP = ""
+	e.ASN = 0
+	e.SetIPv6GeoIP(GeoIP{})
+	e.GeoStatus = GeoStatusPending
+	e.GeoError = err.Error()
+	e.GeoAttempts++
+	e.GeoRetryAt = &retryAt
+}
+
+// UsesShadowTLS reports whether the node is fronted by a ShadowTLS server
+func (e *Entry) UsesShadowTLS() bool {
+	return e.ShadowTLSPassword != ""
+}
+
+// ServerPort returns the port clients connect to
+func (e *Entry) ServerPort() int {
+	if e.UsesShadowTLS() && e.ShadowTLSPort != 0 {
+		return e.ShadowTLSPort
+	}
+	return e.Port
+}
+
+// IsUnhealthy reports whether the node has been failing probes for at
+// least the given window
+func (e *Entry) IsUnhealthy(now time.Time, window time.Duration) bool {
+	return e.Status == NodeStatusDown && e.FailingSince != nil && now.Sub(*e.FailingSince) >= window
+}
+
+// IsUnresolvable reports whether the domain of the entry no longer resolves
+func (e *Entry) IsUnresolvable() bool {
+	return e.UnresolvableSince != nil
+}
+
+// ResetResolution forgets the resolution state, for when the address changes
+func (e *Entry) ResetResolution() {
+	e.ResolvedIPs = nil
+	e.ResolvedAt = nil
+	e.ResolveError = ""
+	e.UnresolvableSince = nil
+}
+
+// NormalizeAddress returns the form addresses are stored and looked up
+// in: IP addresses in their canonical notation and domains in lowercase
+func NormalizeAddress(addr string) string {
+	addr = strings.TrimSpace(addr)
+	if ip := net.ParseIP(addr); ip != nil {
+		return ip.String()
+	}
+	return strings.ToLower(addr)
+}
+
+// Resolution records a change in what the domain of an entry resolves to
+type Resolution struct {
+	ID         int       `json:"id"`
+	NodeID     string    `json:"node_id"`
+	Domain     string    `json:"domain"`
+	Addresses  []string  `json:"addresses"`
+	Error      string    `json:"error,omitempty"`
+	ResolvedAt time.Time `json:"resolved_at"`
+}
+
+// NodeStatus represents the result of the latest health probe of a node
+type NodeStatus struct {
+	NodeID      string
+	Status      string
+	LatencyMs   *int
+	LastSeen    *time.Time
+	LastChecked time.Time
+	LastError   string
 }
 
 // ModifyRequest represents a request to modify an entry
 type ModifyRequest struct {
 	NodeName string `json:"node_name,omitempty"`
 	IP       string `json:"ip,omitempty"`
+	// IPv4 and IPv6 are cleared by setting them to ""
+	IPv4    *string `json:"ipv4,omitempty"`
+	IPv6    *string `json:"ipv6,omitempty"`
+	Port    *int    `json:"port,omitempty"`
+	PSK     *string `json:"psk,omitempty"`
+	Version *string `json:"version,omitempty"`
+	// The snell transport options are pointers so that they can be
+	// cleared by setting them to their zero value
+	Obfs              *string `json:"obfs,omitempty"`
+	ObfsHost          *string `json:"obfs_host,omitempty"`
+	ShadowTLSPassword *string `json:"shadow_tls_password,omitempty"`
+	ShadowTLSSNI      *string `json:"shadow_tls_sni,omitempty"`
+	ShadowTLSVersion  *int    `json:"shadow_tls_version,omitempty"`
+	ShadowTLSPort     *int    `json:"shadow_tls_port,omitempty"`
+	TFO               *bool   `json:"tfo,omitempty"`
+	Reuse             *bool   `json:"reuse,omitempty"`
+	// RelayNodeID and RelayPolicy are cleared by setting them to ""
+	RelayNodeID *string `json:"relay_node_id,omitempty"`
+	RelayPolicy *string `json:"relay_policy,omitempty"`
+}
+
+// transportFields and relayFields are the JSON names of the options that
+// are validated together
+var (
+	transportFields = []string{
+		"obfs", "obfs_host", "shadow_tls_password", "shadow_tls_sni", "shadow_tls_version", "shadow_tls_port", "tfo", "reuse",
+	}
+	relayFields = []string{"relay_node_id", "relay_policy"}
+)
+
+// Fields returns the JSON names of the entry fields the request changes.
+// Changing ip also changes ipv4 and ipv6, and changing any transport or
+// relay option lists every option of the group, as they depend on each
+// other.
+func (m *ModifyRequest) Fields() []string {
+	var fields []string
+	if m.NodeName != "" {
+		fields = append(fields, "node_name")
+	}
+	if m.IP != "" {
+		fields = append(fields, "ip", "ipv4", "ipv6")
+	} else {
+		if m.IPv4 != nil {
+			fields = append(fields, "ipv4")
+		}
+		if m.IPv6 != nil {
+			fields = append(fields, "ipv6")
+		}
+	}
+	if m.Port != nil {
+		fields = append(fields, "port")
+	}
+	if m.PSK != nil {
+		fields = append(fields, "psk")
+	}
+	if m.Version != nil {
+		fields = append(fields, "version")
+	}
+	if m.HasTransport() {
+		fields = append(fields, transportFields...)
+	}
+	if m.HasRelay() {
+		fields = append(fields, relayFields...)
+	}
+	return fields
+}
+
+// HasRelay reports whether the request changes the relay of the node
+func (m *ModifyRequest) HasRelay() bool {
+	return m.RelayNodeID != nil || m.RelayPolicy != nil
+}
+
+// ApplyRelay copies the relay settings set in the request to an entry
+func (m *ModifyRequest) ApplyRelay(entry *Entry) {
+	if m.RelayNodeID != nil {
+		entry.RelayNodeID = *m.RelayNodeID
+	}
+	if m.RelayPolicy != nil {
+		entry.RelayPolicy = *m.RelayPolicy
+	}
+}
+
+// HasTransport reports whether the request changes any snell transport option
+func (m *ModifyRequest) HasTransport() bool {
+	return m.Obfs != nil || m.ObfsHost != nil ||
+		m.ShadowTLSPassword != nil || m.ShadowTLSSNI != nil || m.ShadowTLSVersion != nil || m.ShadowTLSPort != nil ||
+		m.TFO != nil || m.Reuse != nil
+}
+
+// ApplyTransport copies the snell transport options set in the request
+// to an entry
+func (m *ModifyRequest) ApplyTransport(entry *Entry) {
+	if m.Obfs != nil {
+		entry.Obfs = *m.Obfs
+	}
+	if m.ObfsHost != nil {
+		entry.ObfsHost = *m.ObfsHost
+	}
+	if m.ShadowTLSPassword != nil {
+		entry.ShadowTLSPassword = *m.ShadowTLSPassword
+	}
+	if m.ShadowTLSSNI != nil {
+		entry.ShadowTLSSNI = *m.ShadowTLSSNI
+	}
+	if m.ShadowTLSVersion != nil {
+		entry.ShadowTLSVersion = *m.ShadowTLSVersion
+	}
+	if m.ShadowTLSPort != nil {
+		entry.ShadowTLSPort = *m.ShadowTLSPort
+	}
+	if m.TFO != nil {
+		entry.TFO = *m.TFO
+	}
+	if m.Reuse != nil {
+		entry.Reuse = *m.Reuse
+	}
 }
 
 // GeoIP represents IP geolocation information
@@ -46,7 +346,13 @@ type GeoIP struct {
 
 // ApiResponse represents a standardized API response
 type ApiResponse struct {
-	Status  string      `json:"status"`
+	Status string `json:"status"`
+	// Code is the machine-readable error code of a failed request
+	Code    string      `json:"code,omitempty"`
 	Message string      `json:"message"`
 	Data    interface{} `json:"data,omitempty"`
+	// Meta describes the page of a paginated list
+	Meta *PageMeta `json:"meta,omitempty"`
+	// Errors lists the invalid fields of a rejected request
+	Errors []FieldError `json:"errors,omitempty"`
 }
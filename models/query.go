@@ -0,0 +1,68 @@
+/*
+ * @Author: Vincent Yang
+ * @Date: 2026-10-17 22:15:44
+ * @LastEditors: Vincent Yang
+ * @LastEditTime: 2026-10-17 22:15:44
+ * @FilePath: /snell-panel/models/query.go
+ * @Telegram: https://t.me/missuo
+ * @GitHub: https://github.com/missuo
+ *
+ * Copyright © 2026 by Vincent, All Rights Reserved.
+ */
+
+package models
+
+// Fields entries can be sorted by
+const (
+	SortID      = "id"
+	SortName    = "name"
+	SortCountry = "country"
+	SortLatency = "latency"
+)
+
+// EntryQuery selects, sorts and paginates entries. Empty filters match
+// every entry.
+type EntryQuery struct {
+	// CountryCode matches the country code exactly, ignoring case
+	CountryCode string
+	// ASN matches the AS number exactly when not 0
+	ASN int
+	// ISP matches ISPs containing the text, ignoring case
+	ISP string
+	// Version matches the snell version exactly
+	Version string
+	// Name matches node names containing the text, ignoring case
+	Name string
+	// Keyword matches node names containing the text, respecting case
+	Keyword string
+	// Address matches domains, IPv4 or IPv6 addresses containing the text
+	Address string
+	// Tags matches nodes carrying at least one tag of every clause
+	Tags [][]string
+	// ExcludeTags drops nodes carrying any of the tags
+	ExcludeTags []string
+	// Sort is the field to sort by, SortID when empty
+	Sort string
+	// Desc sorts in descending order
+	Desc bool
+	// Limit is the page size, 0 returns every matching entry
+	Limit int
+	// Cursor continues after the last entry of a previous page
+	Cursor string
+}
+
+// EntryPage is a page of entries matching an EntryQuery
+type EntryPage struct {
+	Entries []Entry
+	Meta    PageMeta
+}
+
+// PageMeta describes the page returned by a paginated list
+type PageMeta struct {
+	// Total is the number of entries matching the filters across all pages
+	Total int `json:"total"`
+	// Limit is the page size, omitted when the list is not paginated
+	Limit int `json:"limit,omitempty"`
+	// NextCursor fetches the next page, omitted on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
+}
@@ -0,0 +1,74 @@
+/*
+ * @Author: Vincent Yang
+ * @Date: 2026-10-18 00:12:40
+ * @LastEditors: Vincent Yang
+ * @LastEditTime: 2026-10-18 00:12:40
+ * @FilePath: /snell-panel/models/subscription.go
+ * @Telegram: https://t.me/missuo
+ * @GitHub: https://github.com/missuo
+ *
+ * Copyright © 2026 by Vincent, All Rights Reserved.
+ */
+
+package models
+
+import "time"
+
+// SavedSubscription is a named set of subscription settings stored on the
+// server and served without an API token at a URL containing its slug
+type SavedSubscription struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	// Slug is the unguessable secret identifying the subscription URL
+	Slug string `json:"slug"`
+	// URL is the absolute subscription URL, filled in by the handlers
+	URL string `json:"url,omitempty"`
+	// Format, Filter, Tags, ExcludeTags, IPVersion and HealthyOnly select
+	// and render nodes like the query parameters of GET /subscribe
+	Format      string `json:"format"`
+	Filter      string `json:"filter"`
+	Tags        string `json:"tags"`
+	ExcludeTags string `json:"exclude_tags"`
+	IPVersion   string `json:"ip_version"`
+	HealthyOnly *bool  `json:"healthy_only"`
+	// Include and Exclude select nodes by regular expression, and Rename
+	// rewrites their names, like the query parameters of GET /subscribe
+	Include string       `json:"include"`
+	Exclude string       `json:"exclude"`
+	Rename  []RenameRule `json:"rename"`
+	// ShowFlag prefixes node names with the country flag emoji
+	ShowFlag bool `json:"flag"`
+	// NameTemplate renders node names, the default naming when empty
+	NameTemplate string `json:"name_template"`
+	// Via is the policy every node is relayed through
+	Via string `json:"via"`
+	// Group names the policy group wrapping every node
+	Group     string    `json:"group"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// RenameRule replaces every match of a regular expression in node names
+type RenameRule struct {
+	Pattern string `json:"pattern"`
+	// Replacement may refer to submatches as $1 or ${name}
+	Replacement string `json:"replacement"`
+}
+
+// SavedSubscriptionRequest creates or replaces a saved subscription
+type SavedSubscriptionRequest struct {
+	Name         string       `json:"name"`
+	Format       string       `json:"format"`
+	Filter       string       `json:"filter"`
+	Tags         string       `json:"tags"`
+	ExcludeTags  string       `json:"exclude_tags"`
+	IPVersion    string       `json:"ip_version"`
+	HealthyOnly  *bool        `json:"healthy_only"`
+	Include      string       `json:"include"`
+	Exclude      string       `json:"exclude"`
+	Rename       []RenameRule `json:"rename"`
+	ShowFlag     *bool        `json:"flag"`
+	NameTemplate string       `json:"name_template"`
+	Via          string       `json:"via"`
+	Group        string       `json:"group"`
+}
@@ -0,0 +1,97 @@
+/*
+ * @Author: Vincent Yang
+ * @Date: 2026-10-17 23:24:06
+ * @LastEditors: Vincent Yang
+ * @LastEditTime: 2026-10-17 23:24:06
+ * @FilePath: /snell-panel/models/tags.go
+ * @Telegram: https://t.me/missuo
+ * @GitHub: https://github.com/missuo
+ *
+ * Copyright © 2026 by Vincent, All Rights Reserved.
+ */
+
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// tagPattern matches a normalized tag
+var tagPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,31}$`)
+
+// Tag is a label shared by any number of nodes
+type Tag struct {
+	Name string `json:"name"`
+	// Count is the number of nodes carrying the tag
+	Count int `json:"count"`
+}
+
+// TagRequest tags or untags several nodes at once
+type TagRequest struct {
+	NodeIDs []string `json:"node_ids" binding:"required"`
+	Tags    []string `json:"tags" binding:"required"`
+}
+
+// NormalizeTag lowercases a tag and checks that it only contains
+// letters, digits, dots, dashes and underscores
+func NormalizeTag(tag string) (string, error) {
+	normalized := strings.ToLower(strings.TrimSpace(tag))
+	if !tagPattern.MatchString(normalized) {
+		return "", fmt.Errorf("invalid tag %q: use up to 32 letters, digits, dots, dashes or underscores", tag)
+	}
+	return normalized, nil
+}
+
+// NormalizeTags normalizes a list of tags and drops duplicates
+func NormalizeTags(tags []string) ([]string, error) {
+	seen := make(map[string]bool, len(tags))
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		name, err := NormalizeTag(tag)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[name] {
+			seen[name] = true
+			normalized = append(normalized, name)
+		}
+	}
+	return normalized, nil
+}
+
+// ParseTagList parses a comma-separated list of tags
+func ParseTagList(value string) ([]string, error) {
+	if value == "" {
+		return nil, nil
+	}
+	return NormalizeTags(strings.Split(value, ","))
+}
+
+// ParseTagFilter parses a tag filter expression. Commas separate the
+// tags a node must all carry and "|" separates alternatives, so
+// "hk|jp,iplc" selects nodes tagged iplc and either hk or jp.
+func ParseTagFilter(value string) ([][]string, error) {
+	if value == "" {
+		return nil, nil
+	}
+	var filter [][]string
+	for _, clause := range strings.Split(value, ",") {
+		alternatives, err := NormalizeTags(strings.Split(clause, "|"))
+		if err != nil {
+			return nil, err
+		}
+		filter = append(filter, alternatives)
+	}
+	return filter, nil
+}
+
+// FormatTagFilter formats a parsed tag filter back into its expression
+func FormatTagFilter(filter [][]string) string {
+	clauses := make([]string, len(filter))
+	for i, alternatives := range filter {
+		clauses[i] = strings.Join(alternatives, "|")
+	}
+	return strings.Join(clauses, ",")
+}
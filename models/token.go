@@ -0,0 +1,82 @@
+/*
+ * @Author: Vincent Yang
+ * @Date: 2026-10-17 16:10:31
+ * @LastEditors: Vincent Yang
+ * @LastEditTime: 2026-10-17 16:10:31
+ * @FilePath: /snell-panel/models/token.go
+ * @Telegram: https://t.me/missuo
+ * @GitHub: https://github.com/missuo
+ *
+ * Copyright © 2026 by Vincent, All Rights Reserved.
+ */
+
+package models
+
+import "time"
+
+// Token scopes, from the narrowest to the broadest
+const (
+	// ScopeSubscribe allows fetching subscriptions and profiles
+	ScopeSubscribe = "subscribe"
+	// ScopeEntriesRead allows listing entries, and implies ScopeSubscribe
+	ScopeEntriesRead = "entries:read"
+	// ScopeEntriesWrite allows creating, modifying and deleting entries,
+	// and implies ScopeEntriesRead
+	ScopeEntriesWrite = "entries:write"
+	// ScopeAdmin allows everything, including managing tokens
+	ScopeAdmin = "admin"
+)
+
+// impliedScopes lists the scopes granted by each scope
+var impliedScopes = map[string][]string{
+	ScopeSubscribe:    {ScopeSubscribe},
+	ScopeEntriesRead:  {ScopeEntriesRead, ScopeSubscribe},
+	ScopeEntriesWrite: {ScopeEntriesWrite, ScopeEntriesRead, ScopeSubscribe},
+}
+
+// IsValidScope reports whether scope is a known token scope
+func IsValidScope(scope string) bool {
+	_, ok := impliedScopes[scope]
+	return ok || scope == ScopeAdmin
+}
+
+// Token represents a named API token
+type Token struct {
+	ID        int        `json:"id"`
+	Name      string     `json:"name"`
+	Prefix    string     `json:"prefix"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	// Token is the plaintext secret, only returned when the token is created
+	Token string `json:"token,omitempty"`
+	// Hash is the SHA-256 hex digest of the secret stored in the database
+	Hash string `json:"-"`
+}
+
+// HasScope reports whether the token grants the required scope
+func (t *Token) HasScope(required string) bool {
+	for _, scope := range t.Scopes {
+		if scope == ScopeAdmin {
+			return true
+		}
+		for _, implied := range impliedScopes[scope] {
+			if implied == required {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// IsExpired reports whether the token has expired at the given time
+func (t *Token) IsExpired(now time.Time) bool {
+	return t.ExpiresAt != nil && !now.Before(*t.ExpiresAt)
+}
+
+// CreateTokenRequest represents a request to mint a new token
+type CreateTokenRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
@@ -13,285 +13,375 @@
 package service
 
 import (
-	"database/sql"
+	"context"
 	"fmt"
-	"strings"
+	"log"
+	"text/template"
+	"time"
 
 	"snell-panel/config"
 	"snell-panel/database"
+	"snell-panel/geoip"
 	"snell-panel/handlers"
 	"snell-panel/models"
+	"snell-panel/subscription"
 	"snell-panel/utils"
+	"snell-panel/worker"
 
 	"github.com/gin-gonic/gin"
 )
 
 // Service represents the main service layer
 type Service struct {
-	DB     *sql.DB
+	Repo   database.Repository
 	Config *config.Config
+	Geo    geoip.Provider
+	// NameTemplate names the nodes of subscriptions that do not set their
+	// own template, nil for the built-in naming
+	NameTemplate *template.Template
 }
 
-// InitConfig initializes and returns the application configuration
-func InitConfig() *config.Config {
-	return config.LoadConfig()
-}
+// Type assertion to ensure Service implements the handlers' service interface
+var _ handlers.Service = (*Service)(nil)
 
 // NewService creates a new service instance
 func NewService(cfg *config.Config) *Service {
-	db := database.InitDB(cfg.DatabaseURL)
+	geo, err := geoip.New(geoip.Options{
+		Providers: cfg.GeoIPProviders,
+		CountryDB: cfg.GeoIPCountryDB,
+		ASNDB:     cfg.GeoIPASNDB,
+	})
+	if err != nil {
+		log.Fatalf("Failed to initialize GeoIP provider: %v", err)
+	}
+	log.Printf("Using GeoIP provider %s", geo.Name())
+
+	var nameTemplate *template.Template
+	if cfg.NameTemplate != "" {
+		nameTemplate, err = subscription.ParseNameTemplate(cfg.NameTemplate)
+		if err != nil {
+			log.Fatalf("Invalid NAME_TEMPLATE: %v", err)
+		}
+	}
+
+	repo := database.InitDB(cfg.DatabaseURL)
 	return &Service{
-		DB:     db,
-		Config: cfg,
+		Repo:         repo,
+		Config:       cfg,
+		Geo:          geo,
+		NameTemplate: nameTemplate,
+	}
+}
+
+// StartWorkers starts the background jobs enabled in the configuration.
+// They stop when the context is cancelled.
+func (s *Service) StartWorkers(ctx context.Context) {
+	if s.Config.ProbeInterval > 0 {
+		prober := worker.NewProber(s.Repo, s.Config.ProbeInterval, s.Config.ProbeTimeout)
+		go prober.Run(ctx)
+		log.Printf("Node health prober started, interval %s", s.Config.ProbeInterval)
+	}
+	if s.Config.GeoRetryInterval > 0 {
+		enricher := worker.NewGeoEnricher(s.Repo, s.Geo, s.Config.GeoRetryInterval, s.Config.GeoMaxAttempts)
+		go enricher.Run(ctx)
+		log.Printf("Geolocation retry worker started, interval %s", s.Config.GeoRetryInterval)
+	}
+	if s.Config.ResolveInterval > 0 {
+		resolver := worker.NewResolver(s.Repo, s.Geo, s.Config.ResolveInterval)
+		go resolver.Run(ctx)
+		log.Printf("Domain resolver started, interval %s", s.Config.ResolveInterval)
+	}
+}
+
+// cronTimeout bounds a worker pass run on request, so that it ends within
+// the default function timeout of serverless deployments
+const cronTimeout = 8 * time.Second
+
+// RetryGeoLookups runs one pass of the geolocation retry worker, for
+// deployments such as Vercel that can't run it in the background
+func (s *Service) RetryGeoLookups(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, cronTimeout)
+	defer cancel()
+	enricher := worker.NewGeoEnricher(s.Repo, s.Geo, s.Config.GeoRetryInterval, s.Config.GeoMaxAttempts)
+	return enricher.EnrichPending(ctx)
+}
+
+// ProbeNodes runs one pass of the health prober, for deployments that
+// can't run it in the background
+func (s *Service) ProbeNodes(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, cronTimeout)
+	defer cancel()
+	return worker.NewProber(s.Repo, s.Config.ProbeInterval, s.Config.ProbeTimeout).ProbeAll(ctx)
+}
+
+// ResolveDomains runs one pass of the domain resolver, for deployments
+// that can't run it in the background
+func (s *Service) ResolveDomains(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, cronTimeout)
+	defer cancel()
+	return worker.NewResolver(s.Repo, s.Geo, s.Config.ResolveInterval).ResolveAll(ctx)
+}
+
+// Close releases the resources held by the service
+func (s *Service) Close() {
+	database.CloseDB(s.Repo)
+	if err := geoip.Close(s.Geo); err != nil {
+		log.Printf("Failed to close GeoIP provider: %v", err)
 	}
 }
 
 // Router initializes and returns the gin router
-func Router(cfg *config.Config) *gin.Engine {
+func Router(svc *Service) *gin.Engine {
 	// Set gin mode based on environment
-	if cfg.IsDevelopment {
+	if svc.Config.IsDevelopment {
 		gin.SetMode(gin.DebugMode)
 	} else {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
-	// Create service
-	svc := NewService(cfg)
-
 	// Create handlers with the service
-	h := handlers.NewHandlers(svc.DB, cfg.ApiToken)
-
-	// Initialize router
-	r := gin.Default()
+	h := handlers.NewHandlers(svc)
+	h.PublicURL = svc.Config.PublicURL
+	h.TrustedProxies = svc.Config.TrustedProxies
+
+	// Initialize router with a logger that keeps tokens out of access logs,
+	// taking client IPs from forwarding headers of trusted proxies only
+	r := gin.New()
+	proxies := make([]string, len(svc.Config.TrustedProxies))
+	for i, network := range svc.Config.TrustedProxies {
+		proxies[i] = network.String()
+	}
+	if err := r.SetTrustedProxies(proxies); err != nil {
+		log.Printf("Failed to set trusted proxies: %v", err)
+	}
+	r.Use(handlers.RedactedLogger(), gin.Recovery())
 
 	// Add CORS middleware
 	r.Use(handlers.CorsMiddleware())
 
 	// Routes
-	r.GET("/", h.Welcome)
-	r.POST("/entry", h.AuthMiddleware(), h.InsertEntry)
-	r.GET("/entries", h.AuthMiddleware(), h.QueryAllEntries)
-	r.DELETE("/entry/:ip", h.AuthMiddleware(), h.DeleteEntryByIP)
-	r.DELETE("/entry/node/:node_id", h.AuthMiddleware(), h.DeleteEntryByNodeID)
-	r.GET("/subscribe", h.AuthMiddleware(), h.GetSubscription)
-	r.PUT("/modify/:id", h.AuthMiddleware(), h.ModifyNodeByNodeID)
-	r.NoRoute(h.NotFound)
+	h.RegisterRoutes(r)
 
 	return r
 }
 
-// InsertEntry inserts a new entry into the database
+// InsertEntry inserts a new entry into the database. When the
+// geolocation lookup fails the entry is still stored, with a pending geo
+// status that the background worker retries.
 func (s *Service) InsertEntry(entry *models.Entry) (*models.Entry, error) {
-	// Resolve domain to IP if needed and get IP information
-	// Keep original domain/IP in database, only use resolved IP for getting geo info
-	originalIP := entry.IP
-	_, ipInfo, err := utils.GetIPInfoFromDomainOrIP(entry.IP)
-	if err != nil {
-		return nil, fmt.Errorf("failed to resolve domain/IP or get IP info: %w", err)
+	applyDefaults(entry)
+	if err := s.validateEntry(entry); err != nil {
+		return nil, err
 	}
 
-	// Update entry with IP information (but keep original domain/IP)
-	entry.IP = originalIP // Keep the original domain/IP address
-	entry.CountryCode = ipInfo.CountryCode
-	entry.ISP = ipInfo.ISP
-	entry.ASN = ipInfo.ASN
+	// Keep original domain/IP in database, only use resolved IP for getting geo info
+	s.lookupGeo(entry)
 	entry.NodeID = utils.GenerateUUID()
 
-	// Set default version if not provided
-	if entry.Version == "" {
-		entry.Version = "4"
-	}
-
-	// Insert entry into database
-	var id int
-	err = s.DB.QueryRow(`
-		 INSERT INTO entries (ip, port, psk, country_code, isp, asn, node_id, node_name, version) 
-		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) 
-		 RETURNING id`,
-		entry.IP, entry.Port, entry.PSK, entry.CountryCode, entry.ISP, entry.ASN, entry.NodeID, entry.NodeName, entry.Version).Scan(&id)
-	if err != nil {
+	// Insert entry and its tags into database
+	if err := s.Repo.Create(entry); err != nil {
 		return nil, err
 	}
 
-	// Set ID in entry
-	entry.ID = id
+	// Read the entry back to return it the way listings report it
+	return s.Repo.GetByNodeID(entry.NodeID)
+}
 
-	return entry, nil
+// lookupGeo resolves the entry addresses and fills in their geolocation
+// information, or marks the lookup as pending if it fails
+func (s *Service) lookupGeo(entry *models.Entry) {
+	entry.GeoAttempts = 0
+	err := geoip.ResolveAddresses(entry)
+	if err == nil {
+		err = geoip.Locate(s.Geo, entry)
+	}
+	if err != nil {
+		log.Printf("Geolocation of %s failed, will retry: %v", entry.IP, err)
+		entry.SetGeoPending(err, time.Now().UTC())
+	}
 }
 
 // DeleteEntryByIP deletes an entry by IP address
 func (s *Service) DeleteEntryByIP(ip string) error {
-	result, err := s.DB.Exec("DELETE FROM entries WHERE ip = $1", ip)
-	if err != nil {
-		return err
+	return s.Repo.DeleteByIP(models.NormalizeAddress(ip))
+}
+
+// DeleteEntryByNodeID deletes an entry by node ID
+func (s *Service) DeleteEntryByNodeID(nodeID string) error {
+	return s.Repo.DeleteByNodeID(nodeID)
+}
+
+// QueryEntries retrieves a page of the entries matching a query,
+// explaining which of them healthy-only subscriptions leave out
+func (s *Service) QueryEntries(query models.EntryQuery) (*models.EntryPage, error) {
+	var errs fieldErrors
+	if query.Sort != "" && !database.IsValidEntrySort(query.Sort) {
+		errs.add("sort", "must be one of id, name, country or latency")
+	}
+	if query.Limit < 0 || query.Limit > maxPageLimit {
+		errs.add("limit", "must be between 1 and %d", maxPageLimit)
+	}
+	if err := errs.err(); err != nil {
+		return nil, err
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	page, err := s.Repo.QueryEntries(query)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if rowsAffected == 0 {
-		return fmt.Errorf("entry not found")
+	now := time.Now()
+	for i := range page.Entries {
+		s.annotateHealth(&page.Entries[i], now)
 	}
-
-	return nil
+	return page, nil
 }
 
-// DeleteEntryByNodeID deletes an entry by node ID
-func (s *Service) DeleteEntryByNodeID(nodeID string) error {
-	result, err := s.DB.Exec("DELETE FROM entries WHERE node_id = $1", nodeID)
+// GetEntry retrieves a single entry by node ID, explaining why
+// healthy-only subscriptions leave it out if they do
+func (s *Service) GetEntry(nodeID string) (*models.Entry, error) {
+	entry, err := s.Repo.GetByNodeID(nodeID)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	s.annotateHealth(entry, time.Now())
+	return entry, nil
+}
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return err
+// GetResolutions returns the resolution history of a node, newest first
+func (s *Service) GetResolutions(nodeID string) ([]models.Resolution, error) {
+	if _, err := s.Repo.GetByNodeID(nodeID); err != nil {
+		return nil, err
 	}
+	return s.Repo.ListResolutions(nodeID)
+}
 
-	if rowsAffected == 0 {
-		return fmt.Errorf("entry not found")
+// annotateHealth sets the exclusion reason of an unhealthy entry
+func (s *Service) annotateHealth(entry *models.Entry, now time.Time) {
+	if !entry.IsUnhealthy(now, s.Config.UnhealthyAfter) {
+		return
+	}
+	entry.ExcludedReason = fmt.Sprintf("unreachable since %s", entry.FailingSince.UTC().Format(time.RFC3339))
+	if entry.LastError != "" {
+		entry.ExcludedReason += ": " + entry.LastError
 	}
-
-	return nil
 }
 
-// QueryAllEntries retrieves all entries from the database
-func (s *Service) QueryAllEntries() ([]models.Entry, error) {
-	rows, err := s.DB.Query(`
-		 SELECT id, ip, port, psk, country_code, isp, asn, node_id, node_name 
-		 FROM entries
-	 `)
+// GetSubscription renders the entries selected by the request
+func (s *Service) GetSubscription(req subscription.Request) (*subscription.Document, error) {
+	page, err := s.Repo.QueryEntries(models.EntryQuery{
+		Keyword:     req.Filter,
+		Tags:        req.Tags,
+		ExcludeTags: req.ExcludeTags,
+	})
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	var entries []models.Entry
-	for rows.Next() {
-		var entry models.Entry
-		if err := rows.Scan(
-			&entry.ID, &entry.IP, &entry.Port, &entry.PSK,
-			&entry.CountryCode, &entry.ISP, &entry.ASN,
-			&entry.NodeID, &entry.NodeName,
-		); err != nil {
-			return nil, err
-		}
-		entries = append(entries, entry)
+	entries := page.Entries
+
+	healthyOnly := s.Config.HealthyOnly
+	if req.HealthyOnly != nil {
+		healthyOnly = *req.HealthyOnly
+	}
+	if healthyOnly {
+		entries = s.healthyEntries(entries)
+	}
+	if req.NameTemplate == nil {
+		req.NameTemplate = s.NameTemplate
+	}
+	entries = subscription.FilterIPVersion(entries, req.IPVersion)
+	entries = subscription.FilterRules(entries, req.Options)
+	// Relayed nodes need their relay in the subscription, and filters
+	// win over relays: a node whose relay was left out is dropped
+	entries = subscription.DropBrokenRelays(entries)
+
+	if len(entries) == 0 {
+		return nil, models.ErrNoEntries
 	}
 
-	return entries, nil
+	return subscription.Render(entries, req)
 }
 
-// GetSubscription generates a subscription string for all entries
-func (s *Service) GetSubscription() (string, error) {
-	rows, err := s.DB.Query(`
-		 SELECT ip, port, psk, country_code, isp, asn, node_id, node_name 
-		 FROM entries
-	 `)
-	if err != nil {
-		return "", err
-	}
-	defer rows.Close()
-
-	var subscriptionLines []string
-	for rows.Next() {
-		var entry models.Entry
-		if err := rows.Scan(
-			&entry.IP, &entry.Port, &entry.PSK,
-			&entry.CountryCode, &entry.ISP, &entry.ASN,
-			&entry.NodeID, &entry.NodeName,
-		); err != nil {
-			return "", err
+// healthyEntries drops the entries that have been failing probes for
+// longer than the configured window
+func (s *Service) healthyEntries(entries []models.Entry) []models.Entry {
+	now := time.Now()
+	healthy := entries[:0]
+	for _, entry := range entries {
+		if !entry.IsUnhealthy(now, s.Config.UnhealthyAfter) {
+			healthy = append(healthy, entry)
 		}
+	}
+	return healthy
+}
 
-		emojiFlag := utils.CountryCodeToFlagEmoji(entry.CountryCode)
-		nodeName := entry.NodeName
-		if nodeName == "" {
-			nodeName = fmt.Sprintf("%s %s AS%d %s %s",
-				emojiFlag, entry.CountryCode, entry.ASN, entry.ISP, entry.NodeID)
-		} else {
-			nodeName = fmt.Sprintf("%s %s", emojiFlag, entry.NodeName)
-		}
+// ModifyNodeByNodeID modifies an entry by node ID
+func (s *Service) ModifyNodeByNodeID(nodeID string, modifyReq *models.ModifyRequest) error {
+	_, err := s.PatchEntry(nodeID, modifyReq)
+	return err
+}
 
-		line := fmt.Sprintf("%s = snell, %s, %d, psk = %s, version = 4",
-			nodeName, entry.IP, entry.Port, entry.PSK)
-		subscriptionLines = append(subscriptionLines, line)
+// PatchEntry modifies the fields set in the request on the entry with
+// the given node ID, which never changes, and returns the updated entry
+func (s *Service) PatchEntry(nodeID string, modifyReq *models.ModifyRequest) (*models.Entry, error) {
+	fields := modifyReq.Fields()
+	if len(fields) == 0 {
+		return nil, models.ErrNoFieldsToUpdate
 	}
 
-	if len(subscriptionLines) == 0 {
-		return "", fmt.Errorf("no entries found for subscription")
+	entry, err := s.Repo.GetByNodeID(nodeID)
+	if err != nil {
+		return nil, err
 	}
 
-	return strings.Join(subscriptionLines, "\n"), nil
-}
-
-// ModifyNodeByNodeID modifies node name and/or IP by node ID
-func (s *Service) ModifyNodeByNodeID(nodeID string, modifyReq *models.ModifyRequest) error {
-	// Build query based on which fields are provided
-	query := "UPDATE entries SET"
-	var args []interface{}
-	var setStatements []string
-	paramIndex := 1
-
 	if modifyReq.NodeName != "" {
-		setStatements = append(setStatements, fmt.Sprintf(" node_name = $%d", paramIndex))
-		args = append(args, modifyReq.NodeName)
-		paramIndex++
+		entry.NodeName = modifyReq.NodeName
 	}
-
+	if modifyReq.Port != nil {
+		entry.Port = *modifyReq.Port
+	}
+	if modifyReq.PSK != nil {
+		entry.PSK = *modifyReq.PSK
+	}
+	if modifyReq.Version != nil {
+		entry.Version = *modifyReq.Version
+	}
+	modifyReq.ApplyTransport(entry)
+	modifyReq.ApplyRelay(entry)
+
+	addressChanged := modifyReq.IP != "" || modifyReq.IPv4 != nil || modifyReq.IPv6 != nil
+	if modifyReq.IP != "" && models.NormalizeAddress(modifyReq.IP) != entry.IP {
+		// Forget the addresses of the previous domain/IP address
+		entry.ResetResolution()
+		entry.IPv4, entry.IPv6 = "", ""
+	}
+	// Use original domain/IP address (not resolved IP)
 	if modifyReq.IP != "" {
-		// Resolve domain to IP if needed and get IP information
-		// Keep original domain/IP in database, only use resolved IP for getting geo info
-		_, ipInfo, err := utils.GetIPInfoFromDomainOrIP(modifyReq.IP)
-		if err != nil {
-			return fmt.Errorf("failed to resolve domain/IP or get IP info: %w", err)
-		}
-
-		// Use original domain/IP address (not resolved IP)
-		setStatements = append(setStatements, fmt.Sprintf(" ip = $%d", paramIndex))
-		args = append(args, modifyReq.IP)
-		paramIndex++
-
-		// Update geolocation info
-		setStatements = append(setStatements, fmt.Sprintf(" country_code = $%d", paramIndex))
-		args = append(args, ipInfo.CountryCode)
-		paramIndex++
-
-		setStatements = append(setStatements, fmt.Sprintf(" isp = $%d", paramIndex))
-		args = append(args, ipInfo.ISP)
-		paramIndex++
-
-		setStatements = append(setStatements, fmt.Sprintf(" asn = $%d", paramIndex))
-		args = append(args, ipInfo.ASN)
-		paramIndex++
+		entry.IP = modifyReq.IP
 	}
-
-	// If no fields to update, return error
-	if len(setStatements) == 0 {
-		return fmt.Errorf("no fields to update")
+	if modifyReq.IPv4 != nil {
+		entry.IPv4 = *modifyReq.IPv4
+	}
+	if modifyReq.IPv6 != nil {
+		entry.IPv6 = *modifyReq.IPv6
 	}
 
-	// Combine all set statements
-	query += strings.Join(setStatements, ",")
-	query += fmt.Sprintf(" WHERE node_id = $%d", paramIndex)
-	args = append(args, nodeID)
-
-	// Execute update
-	result, err := s.DB.Exec(query, args...)
-	if err != nil {
-		return err
+	applyDefaults(entry)
+	if err := s.validateFields(entry, fields); err != nil {
+		return nil, err
 	}
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return err
+	if addressChanged {
+		// Update geolocation info
+		s.lookupGeo(entry)
 	}
 
-	if rowsAffected == 0 {
-		return fmt.Errorf("node ID not found")
+	// Only the modified fields are written, so that concurrent changes
+	// to the other fields are not overwritten with what was read above
+	if err := s.Repo.Update(entry, fields); err != nil {
+		return nil, err
 	}
 
-	return nil
+	// Read the entry back to return it with its health status
+	return s.Repo.GetByNodeID(nodeID)
 }
@@ -0,0 +1,167 @@
+/*
+ * @Author: Vincent Yang
+ * @Date: 2026-10-17 10:04:27
+ * @LastEditors: Vincent Yang
+ * @LastEditTime: 2026-10-17 10:04:27
+ * @FilePath: /snell-panel/service/service_test.go
+ * @Telegram: https://t.me/missuo
+ * @GitHub: https://github.com/missuo
+ *
+ * Copyright © 2026 by Vincent, All Rights Reserved.
+ */
+
+package service
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+
+	"snell-panel/models"
+	"snell-panel/subscription"
+)
+
+// subscriptionNames returns the names of the nodes of a Surge subscription
+func subscriptionNames(t *testing.T, s *Service, req subscription.Request) []string {
+	t.Helper()
+	doc, err := s.GetSubscription(req)
+	if errors.Is(err, models.ErrNoEntries) {
+		return nil
+	}
+	if err != nil {
+		t.Fatalf("GetSubscription() error = %v", err)
+	}
+	var names []string
+	for _, line := range strings.Split(strings.TrimSpace(string(doc.Body)), "\n") {
+		name, _, _ := strings.Cut(line, " = ")
+		names = append(names, name)
+	}
+	return names
+}
+
+func TestGetSubscriptionRelays(t *testing.T) {
+	s := newTestService(t)
+
+	hk := validEntry("node-hk")
+	hk.Tags = []string{"iplc"}
+	createEntry(t, s, hk)
+	jp := validEntry("node-jp")
+	jp.NodeName, jp.Port, jp.RelayNodeID = "JP", 444, hk.NodeID
+	createEntry(t, s, jp)
+	us := validEntry("node-us")
+	us.NodeName, us.Port = "US", 445
+	createEntry(t, s, us)
+
+	tests := []struct {
+		name      string
+		req       subscription.Request
+		wantNames []string
+	}{
+		{name: "every node", wantNames: []string{"HK", "JP", "US"}},
+		{name: "filter leaving the relay out", req: subscription.Request{Filter: "JP"}},
+		{name: "excluded relay tag", req: subscription.Request{ExcludeTags: []string{"iplc"}}, wantNames: []string{"US"}},
+		{
+			name:      "excluded relay name",
+			req:       subscription.Request{Options: subscription.Options{Rules: subscription.Rules{Exclude: regexp.MustCompile("HK")}}},
+			wantNames: []string{"US"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			names := subscriptionNames(t, s, tt.req)
+			if strings.Join(names, ",") != strings.Join(tt.wantNames, ",") {
+				t.Errorf("subscription nodes = %v, want %v", names, tt.wantNames)
+			}
+		})
+	}
+}
+
+func TestGetSubscriptionFilterRespectsCase(t *testing.T) {
+	s := newTestService(t)
+	createEntry(t, s, validEntry("node-hk"))
+
+	if names := subscriptionNames(t, s, subscription.Request{Filter: "H"}); strings.Join(names, ",") != "HK" {
+		t.Errorf("filter H = %v, want [HK]", names)
+	}
+	if names := subscriptionNames(t, s, subscription.Request{Filter: "hk"}); len(names) != 0 {
+		t.Errorf("filter hk = %v, want no nodes", names)
+	}
+}
+
+// fakeGeo locates every address in Hong Kong
+type fakeGeo struct{}
+
+func (fakeGeo) Name() string { return "fake" }
+
+func (fakeGeo) Lookup(ip string) (models.GeoIP, error) {
+	return models.GeoIP{CountryCode: "HK", ISP: "Test", ASN: 64500, IP: ip}, nil
+}
+
+func TestPatchEntryValidatesModifiedFields(t *testing.T) {
+	s := newTestService(t)
+
+	// Stored before node names and PSKs were validated
+	legacy := validEntry("node-legacy")
+	legacy.NodeName, legacy.PSK = "HK, 1", "a,b"
+	createEntry(t, s, legacy)
+
+	port := 8443
+	entry, err := s.PatchEntry(legacy.NodeID, &models.ModifyRequest{Port: &port})
+	if err != nil {
+		t.Fatalf("modifying the port of a legacy entry: %v", err)
+	}
+	if entry.Port != port || entry.NodeName != legacy.NodeName {
+		t.Errorf("port, name = %d, %q, want %d, %q", entry.Port, entry.NodeName, port, legacy.NodeName)
+	}
+
+	psk := "c,d"
+	_, err = s.PatchEntry(legacy.NodeID, &models.ModifyRequest{PSK: &psk})
+	if fields := invalidFields(t, err); strings.Join(fields, ",") != "psk" {
+		t.Errorf("invalid fields = %v, want [psk]", fields)
+	}
+}
+
+func TestPatchEntryKeepsOtherFields(t *testing.T) {
+	s := newTestService(t)
+	createEntry(t, s, validEntry("node-1"))
+
+	// A stale copy saving its port must not undo a concurrent PSK change
+	stale, err := s.Repo.GetByNodeID("node-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	psk := "rotated"
+	if _, err := s.PatchEntry("node-1", &models.ModifyRequest{PSK: &psk}); err != nil {
+		t.Fatalf("modifying the psk: %v", err)
+	}
+	stale.Port = 8443
+	if err := s.Repo.Update(stale, []string{"port"}); err != nil {
+		t.Fatalf("saving the port: %v", err)
+	}
+
+	entry, err := s.Repo.GetByNodeID("node-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.PSK != psk || entry.Port != 8443 {
+		t.Errorf("psk, port = %q, %d, want %q, 8443", entry.PSK, entry.Port, psk)
+	}
+}
+
+func TestPatchEntryClearsAddresses(t *testing.T) {
+	s := newTestService(t)
+	s.Geo = fakeGeo{}
+	entry := validEntry("node-1")
+	entry.IPv4, entry.IPv6 = "1.1.1.1", "2606:4700::1111"
+	createEntry(t, s, entry)
+
+	cleared := ""
+	patched, err := s.PatchEntry("node-1", &models.ModifyRequest{IPv6: &cleared})
+	if err != nil {
+		t.Fatalf("clearing ipv6: %v", err)
+	}
+	if patched.IPv4 != "1.1.1.1" || patched.IPv6 != "" {
+		t.Errorf("ipv4, ipv6 = %q, %q, want the IPv6 address cleared", patched.IPv4, patched.IPv6)
+	}
+}
@@ -0,0 +1,236 @@
+/*
+ * @Author: Vincent Yang
+ * @Date: 2026-10-18 00:51:16
+ * @LastEditors: Vincent Yang
+ * @LastEditTime: 2026-10-18 00:51:16
+ * @FilePath: /snell-panel/service/subscriptions.go
+ * @Telegram: https://t.me/missuo
+ * @GitHub: https://github.com/missuo
+ *
+ * Copyright © 2026 by Vincent, All Rights Reserved.
+ */
+
+package service
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"snell-panel/models"
+	"snell-panel/subscription"
+	"snell-panel/utils"
+)
+
+// maxSubscriptionNameLength is the longest saved subscription name in characters
+const maxSubscriptionNameLength = 64
+
+// CreateSavedSubscription stores a new saved subscription with a fresh slug
+func (s *Service) CreateSavedSubscription(req *models.SavedSubscriptionRequest) (*models.SavedSubscription, error) {
+	sub := &models.SavedSubscription{}
+	if err := applySubscriptionRequest(sub, req); err != nil {
+		return nil, err
+	}
+
+	slug, err := utils.GenerateSlug()
+	if err != nil {
+		return nil, err
+	}
+	sub.Slug = slug
+
+	if err := s.Repo.CreateSubscription(sub); err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+// ListSavedSubscriptions retrieves every saved subscription
+func (s *Service) ListSavedSubscriptions() ([]models.SavedSubscription, error) {
+	return s.Repo.ListSubscriptions()
+}
+
+// GetSavedSubscription retrieves a saved subscription by ID
+func (s *Service) GetSavedSubscription(id int) (*models.SavedSubscription, error) {
+	return s.Repo.GetSubscription(id)
+}
+
+// UpdateSavedSubscription replaces the settings of a saved subscription,
+// keeping its URL
+func (s *Service) UpdateSavedSubscription(id int, req *models.SavedSubscriptionRequest) (*models.SavedSubscription, error) {
+	sub, err := s.Repo.GetSubscription(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := applySubscriptionRequest(sub, req); err != nil {
+		return nil, err
+	}
+
+	if err := s.Repo.UpdateSubscription(sub); err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+// RotateSavedSubscription gives a saved subscription a new slug, so its
+// previous URL stops working
+func (s *Service) RotateSavedSubscription(id int) (*models.SavedSubscription, error) {
+	sub, err := s.Repo.GetSubscription(id)
+	if err != nil {
+		return nil, err
+	}
+
+	slug, err := utils.GenerateSlug()
+	if err != nil {
+		return nil, err
+	}
+	sub.Slug = slug
+
+	if err := s.Repo.UpdateSubscription(sub); err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+// DeleteSavedSubscription deletes a saved subscription by ID
+func (s *Service) DeleteSavedSubscription(id int) error {
+	return s.Repo.DeleteSubscription(id)
+}
+
+// RenderSavedSubscription renders the saved subscription with the given
+// slug. profile sets the managed profile header of the surge-profile format.
+func (s *Service) RenderSavedSubscription(slug string, profile subscription.ProfileOptions) (*subscription.Document, error) {
+	sub, err := s.Repo.GetSubscriptionBySlug(slug)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := savedSubscriptionRequest(sub)
+	if err != nil {
+		return nil, err
+	}
+	req.Profile = profile
+	return s.GetSubscription(req)
+}
+
+// applySubscriptionRequest validates a saved subscription request and
+// copies its normalized settings into sub
+func applySubscriptionRequest(sub *models.SavedSubscription, req *models.SavedSubscriptionRequest) error {
+	var errs fieldErrors
+
+	name := strings.TrimSpace(req.Name)
+	switch {
+	case name == "":
+		errs.add("name", "is required")
+	case utf8.RuneCountInString(name) > maxSubscriptionNameLength:
+		errs.add("name", "must be at most %d characters", maxSubscriptionNameLength)
+	}
+
+	format, err := subscription.ParseFormat(req.Format)
+	if err != nil {
+		errs.add("format", "must be surge, clash, sing-box or surge-profile")
+	}
+	tags, err := models.ParseTagFilter(req.Tags)
+	if err != nil {
+		errs.add("tags", "%v", err)
+	}
+	excludeTags, err := models.ParseTagList(req.ExcludeTags)
+	if err != nil {
+		errs.add("exclude_tags", "%v", err)
+	}
+	ipVersion, err := subscription.ParseIPVersion(req.IPVersion)
+	if err != nil {
+		errs.add("ip_version", "must be 4, 6 or dual")
+	}
+	if _, err := subscription.ParseNameTemplate(req.NameTemplate); req.NameTemplate != "" && err != nil {
+		errs.add("name_template", "%v", err)
+	}
+	if _, err := subscription.CompilePattern(req.Include); err != nil {
+		errs.add("include", "%v", err)
+	}
+	if _, err := subscription.CompilePattern(req.Exclude); err != nil {
+		errs.add("exclude", "%v", err)
+	}
+	if _, err := subscription.CompileRename(req.Rename); err != nil {
+		errs.add("rename", "%v", err)
+	}
+	if strings.ContainsAny(req.Via, ",=\r\n") {
+		errs.add("via", "must not contain commas, equals signs or line breaks")
+	}
+	if strings.ContainsAny(req.Group, ",=\r\n") {
+		errs.add("group", "must not contain commas, equals signs or line breaks")
+	}
+	if err := errs.err(); err != nil {
+		return err
+	}
+
+	sub.Name = name
+	sub.Format = string(format)
+	sub.Filter = req.Filter
+	sub.Tags = models.FormatTagFilter(tags)
+	sub.ExcludeTags = strings.Join(excludeTags, ",")
+	sub.IPVersion = string(ipVersion)
+	sub.HealthyOnly = req.HealthyOnly
+	sub.Include = req.Include
+	sub.Exclude = req.Exclude
+	sub.Rename = req.Rename
+	if sub.Rename == nil {
+		sub.Rename = []models.RenameRule{}
+	}
+	// Show flags unless explicitly disabled, like the flag query parameter
+	sub.ShowFlag = req.ShowFlag == nil || *req.ShowFlag
+	sub.NameTemplate = req.NameTemplate
+	sub.Via = req.Via
+	sub.Group = req.Group
+	return nil
+}
+
+// savedSubscriptionRequest converts a saved subscription into the
+// subscription request it describes
+func savedSubscriptionRequest(sub *models.SavedSubscription) (subscription.Request, error) {
+	format, err := subscription.ParseFormat(sub.Format)
+	if err != nil {
+		return subscription.Request{}, err
+	}
+	tags, err := models.ParseTagFilter(sub.Tags)
+	if err != nil {
+		return subscription.Request{}, err
+	}
+	excludeTags, err := models.ParseTagList(sub.ExcludeTags)
+	if err != nil {
+		return subscription.Request{}, err
+	}
+	ipVersion, err := subscription.ParseIPVersion(sub.IPVersion)
+	if err != nil {
+		return subscription.Request{}, err
+	}
+
+	opts := subscription.Options{
+		Via:       sub.Via,
+		ShowFlag:  sub.ShowFlag,
+		IPVersion: ipVersion,
+	}
+	if opts.Rules.Include, err = subscription.CompilePattern(sub.Include); err != nil {
+		return subscription.Request{}, err
+	}
+	if opts.Rules.Exclude, err = subscription.CompilePattern(sub.Exclude); err != nil {
+		return subscription.Request{}, err
+	}
+	if opts.Rules.Rename, err = subscription.CompileRename(sub.Rename); err != nil {
+		return subscription.Request{}, err
+	}
+	if sub.NameTemplate != "" {
+		opts.NameTemplate, err = subscription.ParseNameTemplate(sub.NameTemplate)
+		if err != nil {
+			return subscription.Request{}, err
+		}
+	}
+
+	return subscription.Request{
+		Options:     opts,
+		Format:      format,
+		Filter:      sub.Filter,
+		Tags:        tags,
+		ExcludeTags: excludeTags,
+		Group:       sub.Group,
+		HealthyOnly: sub.HealthyOnly,
+	}, nil
+}
@@ -0,0 +1,73 @@
+/*
+ * @Author: Vincent Yang
+ * @Date: 2026-10-17 23:40:18
+ * @LastEditors: Vincent Yang
+ * @LastEditTime: 2026-10-17 23:40:18
+ * @FilePath: /snell-panel/service/tags.go
+ * @Telegram: https://t.me/missuo
+ * @GitHub: https://github.com/missuo
+ *
+ * Copyright © 2026 by Vincent, All Rights Reserved.
+ */
+
+package service
+
+import (
+	"snell-panel/models"
+)
+
+// maxTagBatch caps the number of nodes and tags of a bulk tag request
+const maxTagBatch = 500
+
+// ListTags retrieves every tag in use with the number of nodes carrying it
+func (s *Service) ListTags() ([]models.Tag, error) {
+	return s.Repo.ListTags()
+}
+
+// TagEntries adds tags to every node of a request
+func (s *Service) TagEntries(req *models.TagRequest) error {
+	tags, err := validateTagRequest(req)
+	if err != nil {
+		return err
+	}
+	return s.Repo.TagEntries(uniqueStrings(req.NodeIDs), tags)
+}
+
+// UntagEntries removes tags from every node of a request
+func (s *Service) UntagEntries(req *models.TagRequest) error {
+	tags, err := validateTagRequest(req)
+	if err != nil {
+		return err
+	}
+	return s.Repo.UntagEntries(uniqueStrings(req.NodeIDs), tags)
+}
+
+// validateTagRequest checks a bulk tag request and returns its
+// normalized tags
+func validateTagRequest(req *models.TagRequest) ([]string, error) {
+	var errs fieldErrors
+	if len(req.NodeIDs) == 0 || len(req.NodeIDs) > maxTagBatch {
+		errs.add("node_ids", "must list between 1 and %d nodes", maxTagBatch)
+	}
+	tags, err := models.NormalizeTags(req.Tags)
+	switch {
+	case err != nil:
+		errs.add("tags", "%v", err)
+	case len(tags) == 0 || len(tags) > maxTagBatch:
+		errs.add("tags", "must list between 1 and %d tags", maxTagBatch)
+	}
+	return tags, errs.err()
+}
+
+// uniqueStrings returns values without duplicates, in their original order
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	unique := make([]string, 0, len(values))
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,117 @@
+/*
+ * @Author: Vincent Yang
+ * @Date: 2026-10-17 16:32:15
+ * @LastEditors: Vincent Yang
+ * @LastEditTime: 2026-10-17 16:32:15
+ * @FilePath: /snell-panel/service/tokens.go
+ * @Telegram: https://t.me/missuo
+ * @GitHub: https://github.com/missuo
+ *
+ * Copyright © 2026 by Vincent, All Rights Reserved.
+ */
+
+package service
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"snell-panel/models"
+	"snell-panel/utils"
+)
+
+// tokenPrefixLength is how many characters of a secret are kept to identify it
+const tokenPrefixLength = 12
+
+// bootstrapToken is the admin token backed by the API_TOKEN setting
+var bootstrapToken = models.Token{
+	Name:   "API_TOKEN",
+	Scopes: []string{models.ScopeAdmin},
+}
+
+// Authenticate returns the token matching the provided secret. API_TOKEN
+// is always accepted as an admin token.
+func (s *Service) Authenticate(secret string) (*models.Token, error) {
+	if secret == "" {
+		return nil, models.ErrInvalidToken
+	}
+
+	// Compare digests so the comparison takes the same time for every secret
+	if subtle.ConstantTimeCompare([]byte(utils.HashToken(secret)), []byte(utils.HashToken(s.Config.ApiToken))) == 1 {
+		token := bootstrapToken
+		return &token, nil
+	}
+
+	token, err := s.Repo.GetTokenByHash(utils.HashToken(secret))
+	if errors.Is(err, models.ErrTokenNotFound) {
+		return nil, models.ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if token.IsExpired(time.Now()) {
+		return nil, models.ErrInvalidToken
+	}
+
+	return token, nil
+}
+
+// CreateToken mints a new named token. The returned token carries the
+// plaintext secret, which is not stored and cannot be retrieved again.
+func (s *Service) CreateToken(req *models.CreateTokenRequest) (*models.Token, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, fmt.Errorf("%w: name is required", models.ErrInvalidRequest)
+	}
+
+	if len(req.Scopes) == 0 {
+		return nil, fmt.Errorf("%w: at least one scope is required", models.ErrInvalidRequest)
+	}
+	for _, scope := range req.Scopes {
+		if !models.IsValidScope(scope) {
+			return nil, fmt.Errorf("%w: unknown scope %q", models.ErrInvalidRequest, scope)
+		}
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresAt != nil {
+		if !req.ExpiresAt.After(time.Now()) {
+			return nil, fmt.Errorf("%w: expires_at must be in the future", models.ErrInvalidRequest)
+		}
+		utc := req.ExpiresAt.UTC()
+		expiresAt = &utc
+	}
+
+	secret, err := utils.GenerateToken()
+	if err != nil {
+		return nil, err
+	}
+
+	token := &models.Token{
+		Name:      name,
+		Prefix:    secret[:tokenPrefixLength],
+		Scopes:    req.Scopes,
+		ExpiresAt: expiresAt,
+		Hash:      utils.HashToken(secret),
+	}
+	if err := s.Repo.CreateToken(token); err != nil {
+		return nil, err
+	}
+
+	token.Token = secret
+	return token, nil
+}
+
+// ListTokens retrieves every token without their secrets
+func (s *Service) ListTokens() ([]models.Token, error) {
+	return s.Repo.ListTokens()
+}
+
+// RevokeToken deletes a token by ID
+func (s *Service) RevokeToken(id int) error {
+	return s.Repo.DeleteToken(id)
+}
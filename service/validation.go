@@ -0,0 +1,276 @@
+/*
+ * @Author: Vincent Yang
+ * @Date: 2026-10-17 21:12:30
+ * @LastEditors: Vincent Yang
+ * @LastEditTime: 2026-10-17 21:12:30
+ * @FilePath: /snell-panel/service/validation.go
+ * @Telegram: https://t.me/missuo
+ * @GitHub: https://github.com/missuo
+ *
+ * Copyright © 2026 by Vincent, All Rights Reserved.
+ */
+
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"snell-panel/models"
+)
+
+const (
+	// defaultSnellVersion is used when an entry omits its snell version
+	defaultSnellVersion = "4"
+	// defaultShadowTLSVersion is used when a ShadowTLS password is set
+	// without a protocol version
+	defaultShadowTLSVersion = 3
+	// maxNodeNameLength is the longest node name in characters
+	maxNodeNameLength = 64
+	// maxPSKLength is the longest pre-shared key in characters
+	maxPSKLength = 128
+	// maxPageLimit caps the page size of entry listings
+	maxPageLimit = 500
+	// maxRelayPolicyLength is the longest relay policy name in characters
+	maxRelayPolicyLength = 64
+	// maxRelayDepth caps how many nodes a relay chain goes through
+	maxRelayDepth = 8
+)
+
+var (
+	// snellVersions lists the snell protocol versions a node can run
+	snellVersions = map[string]bool{"1": true, "2": true, "3": true, "4": true, "5": true}
+	// pskPattern matches the characters a PSK may contain. Commas and
+	// whitespace would break the Surge proxy line.
+	pskPattern = regexp.MustCompile(`^[A-Za-z0-9._~+/=-]+$`)
+	// hostnameLabelPattern matches a single DNS label
+	hostnameLabelPattern = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?$`)
+)
+
+// fieldErrors collects the invalid fields of a request
+type fieldErrors []models.FieldError
+
+// add records an invalid field
+func (f *fieldErrors) add(field, format string, args ...interface{}) {
+	*f = append(*f, models.FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// only returns the errors of the fields for which checked returns true
+func (f fieldErrors) only(checked func(field string) bool) fieldErrors {
+	var kept fieldErrors
+	for _, fieldErr := range f {
+		if checked(fieldErr.Field) {
+			kept = append(kept, fieldErr)
+		}
+	}
+	return kept
+}
+
+// err returns a *models.ValidationError, or nil when every field is valid
+func (f fieldErrors) err() error {
+	if len(f) == 0 {
+		return nil
+	}
+	return &models.ValidationError{Fields: f}
+}
+
+// applyDefaults normalizes the addresses of an entry and fills in the
+// optional fields it omits
+func applyDefaults(entry *models.Entry) {
+	entry.IP = models.NormalizeAddress(entry.IP)
+	if entry.IPv4 != "" {
+		entry.IPv4 = models.NormalizeAddress(entry.IPv4)
+	}
+	if entry.IPv6 != "" {
+		entry.IPv6 = models.NormalizeAddress(entry.IPv6)
+	}
+	if entry.Version == "" {
+		entry.Version = defaultSnellVersion
+	}
+	if entry.UsesShadowTLS() && entry.ShadowTLSVersion == 0 {
+		entry.ShadowTLSVersion = defaultShadowTLSVersion
+	}
+}
+
+// validateEntry checks every client-supplied field of an entry, then
+// that no other entry uses the same address and port
+func (s *Service) validateEntry(entry *models.Entry) error {
+	return s.validateFields(entry, nil)
+}
+
+// validateFields is validateEntry limited to the given fields, named like
+// in JSON, or to every field when fields is nil. Modifying an entry only
+// checks the fields being modified, so that entries stored before a rule
+// existed can still be edited.
+func (s *Service) validateFields(entry *models.Entry, fields []string) error {
+	checked := func(field string) bool {
+		return fields == nil || slices.Contains(fields, field)
+	}
+	var errs fieldErrors
+
+	if !isValidHost(entry.IP) {
+		errs.add("ip", "must be an IP address or a domain name")
+	}
+	if entry.IPv4 != "" && (net.ParseIP(entry.IPv4) == nil || net.ParseIP(entry.IPv4).To4() == nil) {
+		errs.add("ipv4", "must be an IPv4 address")
+	}
+	if entry.IPv6 != "" && (net.ParseIP(entry.IPv6) == nil || net.ParseIP(entry.IPv6).To4() != nil) {
+		errs.add("ipv6", "must be an IPv6 address")
+	}
+	if entry.Port < 1 || entry.Port > 65535 {
+		errs.add("port", "must be between 1 and 65535")
+	}
+
+	switch {
+	case entry.PSK == "":
+		errs.add("psk", "is required")
+	case len(entry.PSK) > maxPSKLength:
+		errs.add("psk", "must be at most %d characters", maxPSKLength)
+	case !pskPattern.MatchString(entry.PSK):
+		errs.add("psk", "may only contain letters, digits and . _ ~ + / = -")
+	}
+
+	if !snellVersions[entry.Version] {
+		errs.add("version", "must be one of 1, 2, 3, 4 or 5")
+	}
+
+	if utf8.RuneCountInString(entry.NodeName) > maxNodeNameLength {
+		errs.add("node_name", "must be at most %d characters", maxNodeNameLength)
+	}
+	if strings.ContainsAny(entry.NodeName, ",=\r\n") {
+		errs.add("node_name", "must not contain commas, equals signs or line breaks")
+	}
+
+	if checked("tags") {
+		tags, err := models.NormalizeTags(entry.Tags)
+		if err != nil {
+			errs.add("tags", "%v", err)
+		}
+		entry.Tags = tags
+	}
+
+	validateTransport(entry, &errs)
+	validateRelay(entry, &errs)
+	if err := errs.only(checked).err(); err != nil {
+		return err
+	}
+	if checked("relay_node_id") {
+		if err := s.checkRelayChain(entry); err != nil {
+			return err
+		}
+	}
+
+	if !checked("ip") && !checked("port") {
+		return nil
+	}
+	inUse, err := s.Repo.AddressInUse(entry.IP, entry.Port, entry.NodeID)
+	if err != nil {
+		return err
+	}
+	if inUse {
+		return fmt.Errorf("%w: %s:%d is already used by another node", models.ErrConflict, entry.IP, entry.Port)
+	}
+	return nil
+}
+
+// validateTransport checks the snell obfs and ShadowTLS options of an entry
+func validateTransport(entry *models.Entry, errs *fieldErrors) {
+	switch entry.Obfs {
+	case "", models.ObfsHTTP, models.ObfsTLS:
+	default:
+		errs.add("obfs", "must be %q or %q", models.ObfsHTTP, models.ObfsTLS)
+	}
+	if entry.ObfsHost != "" {
+		if entry.Obfs == "" {
+			errs.add("obfs_host", "requires obfs")
+		} else if !isValidHost(entry.ObfsHost) {
+			errs.add("obfs_host", "must be a domain name")
+		}
+	}
+
+	if !entry.UsesShadowTLS() {
+		if entry.ShadowTLSSNI != "" || entry.ShadowTLSVersion != 0 || entry.ShadowTLSPort != 0 {
+			errs.add("shadow_tls_password", "is required with the other shadow_tls options")
+		}
+		return
+	}
+	if strings.ContainsAny(entry.ShadowTLSPassword, ", \t\r\n") {
+		errs.add("shadow_tls_password", "must not contain commas or whitespace")
+	}
+	if entry.ShadowTLSSNI == "" {
+		errs.add("shadow_tls_sni", "is required with shadow_tls_password")
+	} else if !isValidHost(entry.ShadowTLSSNI) {
+		errs.add("shadow_tls_sni", "must be a domain name")
+	}
+	if entry.ShadowTLSVersion != 2 && entry.ShadowTLSVersion != 3 {
+		errs.add("shadow_tls_version", "must be 2 or 3")
+	}
+	if entry.ShadowTLSPort < 0 || entry.ShadowTLSPort > 65535 {
+		errs.add("shadow_tls_port", "must be between 1 and 65535")
+	}
+}
+
+// validateRelay checks the relay node and relay policy of an entry
+func validateRelay(entry *models.Entry, errs *fieldErrors) {
+	if entry.RelayNodeID != "" && entry.RelayPolicy != "" {
+		errs.add("relay_node_id", "cannot be set together with relay_policy")
+	}
+	if entry.RelayNodeID != "" && entry.RelayNodeID == entry.NodeID {
+		errs.add("relay_node_id", "must not be the node itself")
+	}
+	if utf8.RuneCountInString(entry.RelayPolicy) > maxRelayPolicyLength {
+		errs.add("relay_policy", "must be at most %d characters", maxRelayPolicyLength)
+	}
+	if strings.ContainsAny(entry.RelayPolicy, ",=\r\n") {
+		errs.add("relay_policy", "must not contain commas, equals signs or line breaks")
+	}
+}
+
+// checkRelayChain follows the relay nodes of an entry, rejecting missing
+// nodes, loops back to the entry and chains longer than maxRelayDepth
+func (s *Service) checkRelayChain(entry *models.Entry) error {
+	var errs fieldErrors
+	for id, depth := entry.RelayNodeID, 1; id != ""; depth++ {
+		if id == entry.NodeID {
+			errs.add("relay_node_id", "would create a relay loop")
+			break
+		}
+		if depth > maxRelayDepth {
+			errs.add("relay_node_id", "must not be more than %d relays deep", maxRelayDepth)
+			break
+		}
+		parent, err := s.Repo.GetByNodeID(id)
+		if errors.Is(err, models.ErrNotFound) {
+			errs.add("relay_node_id", "must be an existing node")
+			break
+		}
+		if err != nil {
+			return err
+		}
+		id = parent.RelayNodeID
+	}
+	return errs.err()
+}
+
+// isValidHost reports whether a string is an IP address or a syntactically
+// valid domain name
+func isValidHost(host string) bool {
+	if net.ParseIP(host) != nil {
+		return true
+	}
+	host = strings.TrimSuffix(host, ".")
+	if host == "" || len(host) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(host, ".") {
+		if !hostnameLabelPattern.MatchString(label) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,217 @@
+/*
+ * @Author: Vincent Yang
+ * @Date: 2026-10-18 18:31:06
+ * @LastEditors: Vincent Yang
+ * @LastEditTime: 2026-10-18 18:31:06
+ * @FilePath: /snell-panel/service/validation_test.go
+ * @Telegram: https://t.me/missuo
+ * @GitHub: https://github.com/missuo
+ *
+ * Copyright © 2026 by Vincent, All Rights Reserved.
+ */
+
+package service
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"snell-panel/config"
+	"snell-panel/database"
+	"snell-panel/models"
+)
+
+// newTestService returns a service backed by a fresh, migrated SQLite
+// database
+func newTestService(t *testing.T) *Service {
+	t.Helper()
+	repo := database.InitDB("sqlite:" + filepath.Join(t.TempDir(), "panel.db"))
+	t.Cleanup(func() { repo.Close() })
+	return &Service{Repo: repo, Config: &config.Config{}}
+}
+
+// validEntry returns an entry that passes validation
+func validEntry(nodeID string) *models.Entry {
+	return &models.Entry{IP: "1.1.1.1", Port: 443, PSK: "secret", Version: "4", NodeID: nodeID, NodeName: "HK"}
+}
+
+// createEntry stores an entry without validating it
+func createEntry(t *testing.T, s *Service, entry *models.Entry) {
+	t.Helper()
+	if err := s.Repo.Create(entry); err != nil {
+		t.Fatalf("creating %s: %v", entry.NodeID, err)
+	}
+}
+
+// invalidFields returns the fields a validation error reports, or fails
+// the test if err is not a validation error
+func invalidFields(t *testing.T, err error) []string {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	var validationErr *models.ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("error = %v, want a validation error", err)
+	}
+	fields := make([]string, len(validationErr.Fields))
+	for i, field := range validationErr.Fields {
+		fields[i] = field.Field
+	}
+	return fields
+}
+
+func TestValidateEntry(t *testing.T) {
+	s := newTestService(t)
+
+	tests := []struct {
+		name       string
+		modify     func(entry *models.Entry)
+		wantFields []string
+	}{
+		{name: "valid", modify: func(*models.Entry) {}},
+		{name: "domain", modify: func(e *models.Entry) { e.IP = "hk.example.com" }},
+		{name: "invalid host", modify: func(e *models.Entry) { e.IP = "not a host" }, wantFields: []string{"ip"}},
+		{name: "ipv4 of the wrong family", modify: func(e *models.Entry) { e.IPv4 = "::1" }, wantFields: []string{"ipv4"}},
+		{name: "ipv6 of the wrong family", modify: func(e *models.Entry) { e.IPv6 = "1.1.1.1" }, wantFields: []string{"ipv6"}},
+		{name: "port out of range", modify: func(e *models.Entry) { e.Port = 70000 }, wantFields: []string{"port"}},
+		{name: "missing psk", modify: func(e *models.Entry) { e.PSK = "" }, wantFields: []string{"psk"}},
+		{name: "psk with a comma", modify: func(e *models.Entry) { e.PSK = "a,b" }, wantFields: []string{"psk"}},
+		{name: "long psk", modify: func(e *models.Entry) { e.PSK = strings.Repeat("a", maxPSKLength+1) }, wantFields: []string{"psk"}},
+		{name: "unknown version", modify: func(e *models.Entry) { e.Version = "6" }, wantFields: []string{"version"}},
+		{name: "name with a comma", modify: func(e *models.Entry) { e.NodeName = "HK, 1" }, wantFields: []string{"node_name"}},
+		{name: "long name", modify: func(e *models.Entry) { e.NodeName = strings.Repeat("节", maxNodeNameLength+1) }, wantFields: []string{"node_name"}},
+		{name: "invalid tag", modify: func(e *models.Entry) { e.Tags = []string{"bad tag"} }, wantFields: []string{"tags"}},
+		{name: "unknown obfs", modify: func(e *models.Entry) { e.Obfs = "ws" }, wantFields: []string{"obfs"}},
+		{name: "obfs host without obfs", modify: func(e *models.Entry) { e.ObfsHost = "example.com" }, wantFields: []string{"obfs_host"}},
+		{
+			name:       "shadow-tls options without password",
+			modify:     func(e *models.Entry) { e.ShadowTLSSNI = "apple.com" },
+			wantFields: []string{"shadow_tls_password"},
+		},
+		{
+			name: "shadow-tls without sni",
+			modify: func(e *models.Entry) {
+				e.ShadowTLSPassword, e.ShadowTLSVersion = "pw", 3
+			},
+			wantFields: []string{"shadow_tls_sni"},
+		},
+		{
+			name: "shadow-tls version",
+			modify: func(e *models.Entry) {
+				e.ShadowTLSPassword, e.ShadowTLSSNI, e.ShadowTLSVersion = "pw", "apple.com", 1
+			},
+			wantFields: []string{"shadow_tls_version"},
+		},
+		{
+			name: "relay node and policy",
+			modify: func(e *models.Entry) {
+				e.RelayNodeID, e.RelayPolicy = "node-other", "Office"
+			},
+			wantFields: []string{"relay_node_id"},
+		},
+		{name: "relay through itself", modify: func(e *models.Entry) { e.RelayNodeID = e.NodeID }, wantFields: []string{"relay_node_id"}},
+		{name: "relay policy with a comma", modify: func(e *models.Entry) { e.RelayPolicy = "a,b" }, wantFields: []string{"relay_policy"}},
+		{name: "relay through a missing node", modify: func(e *models.Entry) { e.RelayNodeID = "node-missing" }, wantFields: []string{"relay_node_id"}},
+		{
+			name: "several invalid fields",
+			modify: func(e *models.Entry) {
+				e.Port, e.PSK = 0, ""
+			},
+			wantFields: []string{"port", "psk"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := validEntry("node-new")
+			tt.modify(entry)
+			applyDefaults(entry)
+			fields := invalidFields(t, s.validateEntry(entry))
+			if strings.Join(fields, ",") != strings.Join(tt.wantFields, ",") {
+				t.Errorf("invalid fields = %v, want %v", fields, tt.wantFields)
+			}
+		})
+	}
+}
+
+func TestApplyDefaults(t *testing.T) {
+	entry := &models.Entry{IP: " HK.Example.com", IPv6: "2606:4700:0:0::1111", ShadowTLSPassword: "pw"}
+	applyDefaults(entry)
+	if entry.Version != defaultSnellVersion || entry.ShadowTLSVersion != defaultShadowTLSVersion {
+		t.Errorf("version, shadow-tls version = %q, %d, want %q, %d",
+			entry.Version, entry.ShadowTLSVersion, defaultSnellVersion, defaultShadowTLSVersion)
+	}
+	if entry.IP != "hk.example.com" || entry.IPv6 != "2606:4700::1111" {
+		t.Errorf("ip, ipv6 = %q, %q, want them normalized", entry.IP, entry.IPv6)
+	}
+}
+
+func TestValidateEntryAddressInUse(t *testing.T) {
+	s := newTestService(t)
+	createEntry(t, s, validEntry("node-1"))
+
+	err := s.validateEntry(validEntry("node-2"))
+	if !errors.Is(err, models.ErrConflict) {
+		t.Fatalf("error = %v, want a conflict", err)
+	}
+
+	// Addresses are compared in their normalized form
+	domain := validEntry("node-3")
+	domain.IP = "hk.example.com"
+	createEntry(t, s, domain)
+	spelled := validEntry("node-4")
+	spelled.IP = "HK.Example.com"
+	applyDefaults(spelled)
+	if err := s.validateEntry(spelled); !errors.Is(err, models.ErrConflict) {
+		t.Errorf("error = %v, want a conflict with the lowercase domain", err)
+	}
+
+	// An entry does not conflict with itself, nor on another port
+	if err := s.validateEntry(validEntry("node-1")); err != nil {
+		t.Errorf("revalidating the stored entry: %v", err)
+	}
+	other := validEntry("node-2")
+	other.Port = 8443
+	if err := s.validateEntry(other); err != nil {
+		t.Errorf("validating another port: %v", err)
+	}
+}
+
+func TestCheckRelayChain(t *testing.T) {
+	s := newTestService(t)
+
+	// node-1 <- node-2 <- … <- node-9, each relayed through the previous one
+	for i := 1; i <= maxRelayDepth+1; i++ {
+		entry := validEntry(fmt.Sprintf("node-%d", i))
+		entry.Port = 1000 + i
+		if i > 1 {
+			entry.RelayNodeID = fmt.Sprintf("node-%d", i-1)
+		}
+		createEntry(t, s, entry)
+	}
+
+	tests := []struct {
+		name       string
+		nodeID     string
+		relay      string
+		wantFields []string
+	}{
+		{name: "chain at the depth limit", nodeID: "node-new", relay: fmt.Sprintf("node-%d", maxRelayDepth)},
+		{name: "chain over the depth limit", nodeID: "node-new", relay: fmt.Sprintf("node-%d", maxRelayDepth+1), wantFields: []string{"relay_node_id"}},
+		{name: "loop through the chain", nodeID: "node-1", relay: "node-3", wantFields: []string{"relay_node_id"}},
+		{name: "missing relay", nodeID: "node-new", relay: "node-missing", wantFields: []string{"relay_node_id"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := validEntry(tt.nodeID)
+			entry.RelayNodeID = tt.relay
+			fields := invalidFields(t, s.checkRelayChain(entry))
+			if strings.Join(fields, ",") != strings.Join(tt.wantFields, ",") {
+				t.Errorf("invalid fields = %v, want %v", fields, tt.wantFields)
+			}
+		})
+	}
+}
@@ -97,6 +97,7 @@ EOL
     fi
 
     IP=$(curl -s -4 ip.sb)
+    IPV6=$(curl -s -6 --max-time 5 ip.sb)
 
     # Extract major version number from SNELL_VERSION
     VERSION_WITHOUT_V=${SNELL_VERSION#v}
@@ -109,9 +110,13 @@ EOL
     if [ ! -z "$NODE_NAME" ]; then
         API_DATA="$API_DATA,\"node_name\":\"$NODE_NAME\""
     fi
+    # If the server has an IPv6 address, register it too
+    if [ ! -z "$IPV6" ]; then
+        API_DATA="$API_DATA,\"ipv6\":\"$IPV6\""
+    fi
     API_DATA="$API_DATA}"
     
-    curl -s -X POST "$API_URL/entry?token=$TOKEN" -H "Content-Type: application/json" \
+    curl -s -X POST "$API_URL/entry" -H "Authorization: Bearer $TOKEN" -H "Content-Type: application/json" \
         -d "$API_DATA"
     echo "API update complete."
 
@@ -171,7 +176,7 @@ uninstall_snell() {
     echo "Deleting entry from API..."
     # Delete entry from API with token
     IP=$(curl -s -4 ip.sb)
-    curl -s -X DELETE "$API_URL/entry/$IP?token=$TOKEN"
+    curl -s -X DELETE "$API_URL/entry/$IP" -H "Authorization: Bearer $TOKEN"
     echo "API entry deleted."
 
     sudo systemctl daemon-reload
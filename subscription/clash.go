@@ -0,0 +1,171 @@
+/*
+ * @Author: Vincent Yang
+ * @Date: 2026-10-17 10:31:05
+ * @LastEditors: Vincent Yang
+ * @LastEditTime: 2026-10-17 10:31:05
+ * @FilePath: /snell-panel/subscription/clash.go
+ * @Telegram: https://t.me/missuo
+ * @GitHub: https://github.com/missuo
+ *
+ * Copyright © 2026 by Vincent, All Rights Reserved.
+ */
+
+package subscription
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"snell-panel/models"
+
+	"gopkg.in/yaml.v3"
+)
+
+// clashMaxSnellVersion is the newest snell protocol version Mihomo implements
+const clashMaxSnellVersion = 3
+
+// clashProxy represents a snell proxy in a Mihomo configuration
+type clashProxy struct {
+	Name        string         `yaml:"name"`
+	Type        string         `yaml:"type"`
+	Server      string         `yaml:"server"`
+	Port        int            `yaml:"port"`
+	PSK         string         `yaml:"psk"`
+	Version     int            `yaml:"version"`
+	ObfsOpts    *clashObfsOpts `yaml:"obfs-opts,omitempty"`
+	TFO         bool           `yaml:"tfo,omitempty"`
+	IPVersion   string         `yaml:"ip-version,omitempty"`
+	DialerProxy string         `yaml:"dialer-proxy,omitempty"`
+}
+
+// clashObfsOpts represents the obfuscation options of a snell proxy
+type clashObfsOpts struct {
+	Mode string `yaml:"mode"`
+	Host string `yaml:"host,omitempty"`
+}
+
+// clashIPVersions maps an IPVersion to the Mihomo ip-version option
+var clashIPVersions = map[IPVersion]string{
+	IPVersion4:    "ipv4",
+	IPVersion6:    "ipv6",
+	IPVersionDual: "dual",
+}
+
+// clashProxyGroup represents a proxy group in a Mihomo configuration
+type clashProxyGroup struct {
+	Name    string   `yaml:"name"`
+	Type    string   `yaml:"type"`
+	Proxies []string `yaml:"proxies"`
+}
+
+// clashConfig represents the subset of a Mihomo configuration we generate
+type clashConfig struct {
+	Proxies     []clashProxy      `yaml:"proxies"`
+	ProxyGroups []clashProxyGroup `yaml:"proxy-groups,omitempty"`
+}
+
+// Clash renders entries as a Mihomo (Clash Meta) proxies document.
+// When group is not empty, a select proxy group with that name
+// containing every node is appended. Mihomo cannot connect to snell
+// through ShadowTLS or to snell servers newer than v3, so those nodes,
+// and the nodes relayed through them, are left out and listed in a
+// comment at the top of the document. When no node is left, an error
+// wrapping models.ErrInvalidRequest lists them instead.
+func Clash(entries []models.Entry, opts Options, group string) ([]byte, error) {
+	config := clashConfig{
+		Proxies: make([]clashProxy, 0, len(entries)),
+	}
+
+	supported := dropRelayedThrough(entries, func(entry models.Entry) bool { return clashUnsupported(entry) != "" })
+	skipped := clashSkipped(entries, supported, opts)
+	entries = supported
+
+	var names []string
+	nodeNames := NodeNames(entries, opts)
+	relays := relayNames(entries, nodeNames, opts)
+	for i, entry := range entries {
+		nodeName := nodeNames[i]
+
+		version, _ := strconv.Atoi(entry.Version)
+
+		var obfsOpts *clashObfsOpts
+		if entry.Obfs != "" {
+			obfsOpts = &clashObfsOpts{Mode: entry.Obfs, Host: entry.ObfsHost}
+		}
+
+		config.Proxies = append(config.Proxies, clashProxy{
+			Name:        nodeName,
+			Type:        "snell",
+			Server:      ServerAddress(entry, opts.IPVersion),
+			Port:        entry.Port,
+			PSK:         entry.PSK,
+			Version:     version,
+			ObfsOpts:    obfsOpts,
+			TFO:         entry.TFO,
+			IPVersion:   clashIPVersions[opts.IPVersion],
+			DialerProxy: relays[i],
+		})
+		names = append(names, nodeName)
+	}
+
+	if len(config.Proxies) == 0 {
+		if len(skipped) > 0 {
+			return nil, fmt.Errorf("%w: Mihomo only supports snell v1 to v3 without ShadowTLS, every node was left out: %s",
+				models.ErrInvalidRequest, strings.Join(skipped, ", "))
+		}
+		return nil, models.ErrNoEntries
+	}
+
+	if group != "" {
+		config.ProxyGroups = []clashProxyGroup{{
+			Name:    group,
+			Type:    "select",
+			Proxies: names,
+		}}
+	}
+
+	body, err := yaml.Marshal(config)
+	if err != nil || len(skipped) == 0 {
+		return body, err
+	}
+	header := "# Left out as Mihomo cannot connect to them: " + strings.Join(skipped, ", ") + "\n"
+	return append([]byte(header), body...), nil
+}
+
+// clashUnsupported returns why Mihomo cannot connect to an entry, or an
+// empty string if it can
+func clashUnsupported(entry models.Entry) string {
+	version, err := strconv.Atoi(entry.Version)
+	if err != nil || version < 1 || version > clashMaxSnellVersion {
+		// A v3 client cannot talk to a newer snell server
+		return "snell v" + entry.Version
+	}
+	if entry.UsesShadowTLS() {
+		return "ShadowTLS"
+	}
+	return ""
+}
+
+// clashSkipped describes the entries that were left out of supported,
+// by name and reason
+func clashSkipped(entries, supported []models.Entry, opts Options) []string {
+	kept := make(map[string]bool, len(supported))
+	for _, entry := range supported {
+		kept[entry.NodeID] = true
+	}
+
+	var skipped []string
+	names := NodeNames(entries, opts)
+	for i, entry := range entries {
+		if kept[entry.NodeID] {
+			continue
+		}
+		reason := clashUnsupported(entry)
+		if reason == "" {
+			reason = "relayed through an unsupported node"
+		}
+		skipped = append(skipped, fmt.Sprintf("%s (%s)", names[i], reason))
+	}
+	return skipped
+}
@@ -0,0 +1,95 @@
+/*
+ * @Author: Vincent Yang
+ * @Date: 2026-10-17 10:21:53
+ * @LastEditors: Vincent Yang
+ * @LastEditTime: 2026-10-17 10:21:53
+ * @FilePath: /snell-panel/subscription/clash_test.go
+ * @Telegram: https://t.me/missuo
+ * @GitHub: https://github.com/missuo
+ *
+ * Copyright © 2026 by Vincent, All Rights Reserved.
+ */
+
+package subscription
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"snell-panel/models"
+)
+
+func TestClash(t *testing.T) {
+	hk := testEntry("node-hk", "HK")
+	hk.Version, hk.Obfs, hk.ObfsHost, hk.TFO = "3", models.ObfsHTTP, "example.com", true
+	exit := testEntry("node-exit", "Exit")
+	exit.Version, exit.RelayNodeID = "3", hk.NodeID
+
+	body, err := Clash([]models.Entry{hk, exit}, Options{IPVersion: IPVersion4, Via: "Home"}, "Proxy")
+	if err != nil {
+		t.Fatalf("Clash() error = %v", err)
+	}
+	want := `proxies:
+    - name: HK - Home
+      type: snell
+      server: 1.1.1.1
+      port: 443
+      psk: secret
+      version: 3
+      obfs-opts:
+        mode: http
+        host: example.com
+      tfo: true
+      ip-version: ipv4
+      dialer-proxy: Home
+    - name: Exit - Home
+      type: snell
+      server: 1.1.1.1
+      port: 443
+      psk: secret
+      version: 3
+      ip-version: ipv4
+      dialer-proxy: HK - Home
+proxy-groups:
+    - name: Proxy
+      type: select
+      proxies:
+        - HK - Home
+        - Exit - Home
+`
+	if string(body) != want {
+		t.Errorf("Clash() =\n%s\nwant\n%s", body, want)
+	}
+}
+
+func TestClashUnsupported(t *testing.T) {
+	v3 := testEntry("node-v3", "V3")
+	v3.Version = "3"
+	v4 := testEntry("node-v4", "V4")
+	shadowTLS := testEntry("node-stls", "STLS")
+	shadowTLS.Version, shadowTLS.ShadowTLSPassword, shadowTLS.ShadowTLSSNI, shadowTLS.ShadowTLSVersion = "3", "pw", "apple.com", 3
+	relayed := testEntry("node-relayed", "Relayed")
+	relayed.Version, relayed.RelayNodeID = "3", v4.NodeID
+
+	body, err := Clash([]models.Entry{v3, v4, shadowTLS, relayed}, Options{}, "")
+	if err != nil {
+		t.Fatalf("Clash() error = %v", err)
+	}
+	header, rest, _ := strings.Cut(string(body), "\n")
+	wantHeader := "# Left out as Mihomo cannot connect to them: V4 (snell v4), STLS (ShadowTLS), Relayed (relayed through an unsupported node)"
+	if header != wantHeader {
+		t.Errorf("header = %q, want %q", header, wantHeader)
+	}
+	if !strings.Contains(rest, "- name: V3\n") || strings.Count(rest, "- name:") != 1 {
+		t.Errorf("Clash() kept other nodes than V3:\n%s", rest)
+	}
+
+	_, err = Clash([]models.Entry{v4, relayed}, Options{}, "")
+	if !errors.Is(err, models.ErrInvalidRequest) || !strings.Contains(err.Error(), "V4 (snell v4)") {
+		t.Errorf("error = %v, want an invalid request naming the skipped nodes", err)
+	}
+	if _, err := Clash(nil, Options{}, ""); !errors.Is(err, models.ErrNoEntries) {
+		t.Errorf("error without entries = %v, want %v", err, models.ErrNoEntries)
+	}
+}
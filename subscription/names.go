@@ -0,0 +1,265 @@
+/*
+ * @Author: Vincent Yang
+ * @Date: 2026-10-18 00:20:03
+ * @LastEditors: Vincent Yang
+ * @LastEditTime: 2026-10-18 00:20:03
+ * @FilePath: /snell-panel/subscription/names.go
+ * @Telegram: https://t.me/missuo
+ * @GitHub: https://github.com/missuo
+ *
+ * Copyright © 2026 by Vincent, All Rights Reserved.
+ */
+
+package subscription
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/language/display"
+
+	"snell-panel/models"
+	"snell-panel/utils"
+)
+
+const (
+	// maxNameTemplateLength is the longest name template in bytes
+	maxNameTemplateLength = 256
+	// maxNameLength caps the output of a name template in bytes
+	maxNameLength = 1024
+	// shortIDLength is how many characters of the node ID ShortID keeps
+	shortIDLength = 8
+)
+
+// DefaultNameTemplate names nodes after their node name, or after their
+// location, network and node ID when they were registered without one.
+// It renders the same names as before templates existed, so that client
+// rules and selections keep matching; use ShortID in NAME_TEMPLATE for
+// shorter names.
+const DefaultNameTemplate = `{{.Flag}} {{if .Name}}{{.Name}}{{else}}{{.Country}} AS{{.ASN}} {{.ISP}} {{.NodeID}}{{end}}`
+
+// defaultNameTemplate is the parsed DefaultNameTemplate
+var defaultNameTemplate = template.Must(ParseNameTemplate(DefaultNameTemplate))
+
+// nameFuncs are the functions available to name templates
+var nameFuncs = template.FuncMap{
+	"join":  strings.Join,
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+// NameData is the data a node name template is executed with
+type NameData struct {
+	// Flag is the country flag emoji, empty when flags are turned off
+	Flag string
+	// Country is the country code and CountryName its English name
+	Country     string
+	CountryName string
+	// Name is the node name, empty when the node was registered without one
+	Name string
+	ASN  int
+	ISP  string
+	// ShortID is the first characters of NodeID
+	ShortID string
+	NodeID  string
+	// Version is the snell protocol version
+	Version string
+	Tags    []string
+}
+
+// nameData returns the template data of an entry
+func nameData(entry models.Entry, showFlag bool) NameData {
+	data := NameData{
+		Country:     entry.CountryCode,
+		CountryName: countryName(entry.CountryCode),
+		Name:        entry.NodeName,
+		ASN:         entry.ASN,
+		ISP:         entry.ISP,
+		ShortID:     entry.NodeID,
+		NodeID:      entry.NodeID,
+		Version:     entry.Version,
+		Tags:        entry.Tags,
+	}
+	if showFlag {
+		data.Flag = utils.CountryCodeToFlagEmoji(entry.CountryCode)
+	}
+	if len(data.ShortID) > shortIDLength {
+		data.ShortID = data.ShortID[:shortIDLength]
+	}
+	if data.Tags == nil {
+		data.Tags = []string{}
+	}
+	return data
+}
+
+// countryName returns the English name of a country code, or the code
+// itself when it is unknown
+func countryName(code string) string {
+	region, err := language.ParseRegion(code)
+	if err != nil {
+		return code
+	}
+	if name := display.English.Regions().Name(region); name != "" {
+		return name
+	}
+	return code
+}
+
+// ParseNameTemplate parses a node name template such as
+// "{{.Flag}} {{.CountryName}} {{.ShortID}}" and checks that it executes
+func ParseNameTemplate(text string) (*template.Template, error) {
+	if len(text) > maxNameTemplateLength {
+		return nil, fmt.Errorf("name template must be at most %d bytes", maxNameTemplateLength)
+	}
+	tmpl, err := template.New("name").Funcs(nameFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if len(tmpl.Templates()) > 1 {
+		return nil, fmt.Errorf("name template must not define templates")
+	}
+	if err := checkNameNodes(tmpl.Tree.Root); err != nil {
+		return nil, err
+	}
+
+	sample := models.Entry{
+		CountryCode: "US",
+		ASN:         13335,
+		ISP:         "Cloudflare",
+		NodeID:      "00000000-0000-0000-0000-000000000000",
+		NodeName:    "Sample",
+		Version:     "4",
+		Tags:        []string{"sample"},
+	}
+	if err := tmpl.Execute(&limitedWriter{}, nameData(sample, true)); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// checkNameNodes rejects the actions that could make a name template
+// loop or recurse, as it is executed for every node of a subscription
+func checkNameNodes(node parse.Node) error {
+	switch node := node.(type) {
+	case *parse.ListNode:
+		if node == nil {
+			return nil
+		}
+		for _, child := range node.Nodes {
+			if err := checkNameNodes(child); err != nil {
+				return err
+			}
+		}
+	case *parse.RangeNode:
+		return fmt.Errorf("name template must not use range")
+	case *parse.TemplateNode:
+		return fmt.Errorf("name template must not include templates")
+	case *parse.IfNode:
+		return checkBranch(&node.BranchNode)
+	case *parse.WithNode:
+		return checkBranch(&node.BranchNode)
+	}
+	return nil
+}
+
+// checkBranch checks both lists of an if or with action
+func checkBranch(branch *parse.BranchNode) error {
+	if err := checkNameNodes(branch.List); err != nil {
+		return err
+	}
+	return checkNameNodes(branch.ElseList)
+}
+
+// limitedWriter collects template output up to maxNameLength bytes
+type limitedWriter struct {
+	strings.Builder
+}
+
+// Write appends p, failing once the output would exceed maxNameLength
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	if w.Len()+len(p) > maxNameLength {
+		return 0, fmt.Errorf("name is longer than %d bytes", maxNameLength)
+	}
+	return w.Builder.Write(p)
+}
+
+// nameSanitizer drops the characters that would break a Surge proxy line
+var nameSanitizer = strings.NewReplacer(",", "", "=", "")
+
+// executeNameTemplate renders the name of an entry with a template,
+// returning an empty string if the template fails
+func executeNameTemplate(tmpl *template.Template, entry models.Entry, showFlag bool) string {
+	var name limitedWriter
+	if err := tmpl.Execute(&name, nameData(entry, showFlag)); err != nil {
+		return ""
+	}
+	return strings.Join(strings.Fields(nameSanitizer.Replace(name.String())), " ")
+}
+
+// baseName renders the name of an entry with the name template and
+// rename rules of opts, before de-duplication and the via suffix
+func baseName(entry models.Entry, opts Options) string {
+	tmpl := opts.NameTemplate
+	if tmpl == nil {
+		tmpl = defaultNameTemplate
+	}
+	name := executeNameTemplate(tmpl, entry, opts.ShowFlag)
+	if name == "" {
+		// Keep nodes addressable when the template renders nothing
+		name = entry.NodeID
+	}
+	return opts.Rules.rename(name)
+}
+
+// withVia adds the " - <via>" suffix of relayed subscriptions to a name
+func withVia(name string, opts Options) string {
+	if opts.Via != "" {
+		return name + " - " + opts.Via
+	}
+	return name
+}
+
+// NodeName returns the display name of an entry in a subscription,
+// without de-duplication
+func NodeName(entry models.Entry, opts Options) string {
+	return withVia(baseName(entry, opts), opts)
+}
+
+// NodeNames returns the display names of entries in a subscription. When
+// several entries render the same name, the later ones get a " 2", " 3"…
+// suffix so every name is unique.
+func NodeNames(entries []models.Entry, opts Options) []string {
+	return uniqueNodeNames(entries, opts, nil)
+}
+
+// uniqueNodeNames returns the display names of entries like NodeNames,
+// also suffixing the names that are reserved, such as policy group names
+func uniqueNodeNames(entries []models.Entry, opts Options, reserved map[string]bool) []string {
+	names := make([]string, len(entries))
+	taken := make(map[string]bool, len(entries))
+	for i, entry := range entries {
+		names[i] = baseName(entry, opts)
+		taken[names[i]] = true
+	}
+
+	seen := make(map[string]int, len(entries))
+	for i, name := range names {
+		seen[name]++
+		if seen[name] > 1 || reserved[withVia(name, opts)] {
+			for n := max(seen[name], 2); ; n++ {
+				candidate := fmt.Sprintf("%s %d", name, n)
+				if !taken[candidate] && !reserved[withVia(candidate, opts)] {
+					taken[candidate] = true
+					seen[name] = n
+					names[i] = candidate
+					break
+				}
+			}
+		}
+		names[i] = withVia(names[i], opts)
+	}
+	return names
+}
@@ -0,0 +1,133 @@
+/*
+ * @Author: Vincent Yang
+ * @Date: 2026-10-17 11:40:53
+ * @LastEditors: Vincent Yang
+ * @LastEditTime: 2026-10-17 11:40:53
+ * @FilePath: /snell-panel/subscription/profile.go
+ * @Telegram: https://t.me/missuo
+ * @GitHub: https://github.com/missuo
+ *
+ * Copyright © 2026 by Vincent, All Rights Reserved.
+ */
+
+package subscription
+
+import (
+	"fmt"
+	"strings"
+
+	"snell-panel/models"
+	"snell-panel/utils"
+)
+
+const (
+	// DefaultProfileInterval is the default managed profile update interval in seconds
+	DefaultProfileInterval = 86400
+	// profileSelectGroup is the default name of the group containing every node
+	profileSelectGroup = "Proxy"
+	// profileOtherRegion is the region group for nodes without a country code
+	profileOtherRegion = "Other"
+	// profileTestURL is the URL probed by the region url-test groups
+	profileTestURL = "http://www.gstatic.com/generate_204"
+	// profileTestInterval is how often the region url-test groups probe nodes
+	profileTestInterval = 600
+)
+
+// ProfileOptions controls the managed profile header
+type ProfileOptions struct {
+	// URL is the address Surge fetches the profile from when updating
+	URL string
+	// Interval is the update interval in seconds
+	Interval int
+	// Strict forces Surge to stop using the profile if an update fails
+	Strict bool
+}
+
+// regionGroup collects the nodes of a single country
+type regionGroup struct {
+	name  string
+	nodes []string
+}
+
+// SurgeProfile renders entries as a complete Surge managed profile with a
+// url-test policy group per country and a select group with every node,
+// named group or "Proxy" when group is empty. Nodes named like a policy
+// group are suffixed, as a group must not contain itself.
+func SurgeProfile(entries []models.Entry, opts Options, profileOpts ProfileOptions, group string) string {
+	if group == "" {
+		group = profileSelectGroup
+	}
+
+	var proxyLines []string
+	var regions []*regionGroup
+	regionIndex := make(map[string]*regionGroup)
+	groupNames := map[string]bool{group: true}
+
+	regionNames := make([]string, len(entries))
+	for i, entry := range entries {
+		regionNames[i] = regionGroupName(entry.CountryCode, opts.ShowFlag)
+		if regionNames[i] == group {
+			// The select group was named after a region
+			regionNames[i] += " 2"
+		}
+		if _, ok := regionIndex[regionNames[i]]; !ok {
+			region := &regionGroup{name: regionNames[i]}
+			regionIndex[regionNames[i]] = region
+			regions = append(regions, region)
+			groupNames[regionNames[i]] = true
+		}
+	}
+
+	nodeNames := uniqueNodeNames(entries, opts, groupNames)
+	relays := relayNames(entries, nodeNames, opts)
+	for i, entry := range entries {
+		nodeName := nodeNames[i]
+		proxyLines = append(proxyLines, surgeLine(entry, nodeName, relays[i], opts))
+
+		region := regionIndex[regionNames[i]]
+		region.nodes = append(region.nodes, nodeName)
+	}
+
+	var groupLines []string
+	selectMembers := make([]string, 0, len(regions)+len(nodeNames))
+	for _, region := range regions {
+		selectMembers = append(selectMembers, region.name)
+	}
+	selectMembers = append(selectMembers, nodeNames...)
+	groupLines = append(groupLines, fmt.Sprintf("%s = select, %s",
+		group, strings.Join(selectMembers, ", ")))
+	for _, region := range regions {
+		groupLines = append(groupLines, fmt.Sprintf("%s = url-test, %s, url = %s, interval = %d",
+			region.name, strings.Join(region.nodes, ", "), profileTestURL, profileTestInterval))
+	}
+
+	interval := profileOpts.Interval
+	if interval <= 0 {
+		interval = DefaultProfileInterval
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "#!MANAGED-CONFIG %s interval=%d strict=%t\n\n", profileOpts.URL, interval, profileOpts.Strict)
+	b.WriteString("[General]\n")
+	b.WriteString("loglevel = notify\n")
+	b.WriteString("skip-proxy = 127.0.0.1, 192.168.0.0/16, 10.0.0.0/8, 172.16.0.0/12, 100.64.0.0/10, localhost, *.local\n\n")
+	b.WriteString("[Proxy]\n")
+	b.WriteString(strings.Join(proxyLines, "\n"))
+	b.WriteString("\n\n[Proxy Group]\n")
+	b.WriteString(strings.Join(groupLines, "\n"))
+	b.WriteString("\n\n[Rule]\n")
+	fmt.Fprintf(&b, "FINAL, %s\n", group)
+
+	return b.String()
+}
+
+// regionGroupName returns the policy group name for a country code
+func regionGroupName(countryCode string, showFlag bool) string {
+	if countryCode == "" {
+		return profileOtherRegion
+	}
+	if showFlag {
+		return fmt.Sprintf("%s %s", utils.CountryCodeToFlagEmoji(countryCode), countryCode)
+	}
+	return countryCode
+}
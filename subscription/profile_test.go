@@ -0,0 +1,77 @@
+/*
+ * @Author: Vincent Yang
+ * @Date: 2026-10-18 18:05:41
+ * @LastEditors: Vincent Yang
+ * @LastEditTime: 2026-10-18 18:05:41
+ * @FilePath: /snell-panel/subscription/profile_test.go
+ * @Telegram: https://t.me/missuo
+ * @GitHub: https://github.com/missuo
+ *
+ * Copyright © 2026 by Vincent, All Rights Reserved.
+ */
+
+package subscription
+
+import (
+	"strings"
+	"testing"
+
+	"snell-panel/models"
+)
+
+func TestSurgeProfile(t *testing.T) {
+	hk := testEntry("node-hk", "HK 1")
+	jp := testEntry("node-jp", "Tokyo")
+	jp.CountryCode = "JP"
+	unknown := testEntry("node-xx", "Somewhere")
+	unknown.CountryCode = ""
+
+	profile := SurgeProfile([]models.Entry{hk, jp, unknown}, Options{}, ProfileOptions{URL: "https://panel.example.com/profile"}, "")
+	want := `#!MANAGED-CONFIG https://panel.example.com/profile interval=86400 strict=false
+
+[General]
+loglevel = notify
+skip-proxy = 127.0.0.1, 192.168.0.0/16, 10.0.0.0/8, 172.16.0.0/12, 100.64.0.0/10, localhost, *.local
+
+[Proxy]
+HK 1 = snell, 1.1.1.1, 443, psk = secret, version = 4
+Tokyo = snell, 1.1.1.1, 443, psk = secret, version = 4
+Somewhere = snell, 1.1.1.1, 443, psk = secret, version = 4
+
+[Proxy Group]
+Proxy = select, HK, JP, Other, HK 1, Tokyo, Somewhere
+HK = url-test, HK 1, url = http://www.gstatic.com/generate_204, interval = 600
+JP = url-test, Tokyo, url = http://www.gstatic.com/generate_204, interval = 600
+Other = url-test, Somewhere, url = http://www.gstatic.com/generate_204, interval = 600
+
+[Rule]
+FINAL, Proxy
+`
+	if profile != want {
+		t.Errorf("SurgeProfile() =\n%s\nwant\n%s", profile, want)
+	}
+}
+
+func TestSurgeProfileHeader(t *testing.T) {
+	profile := SurgeProfile([]models.Entry{testEntry("node-1", "HK")}, Options{}, ProfileOptions{URL: "https://x/profile", Interval: 3600, Strict: true}, "")
+	if header, _, _ := strings.Cut(profile, "\n"); header != "#!MANAGED-CONFIG https://x/profile interval=3600 strict=true" {
+		t.Errorf("header = %q", header)
+	}
+}
+
+func TestSurgeProfileGroupNames(t *testing.T) {
+	// A node named like a region group and a region named like the
+	// select group must not shadow each other
+	named := testEntry("node-1", "HK")
+	profile := SurgeProfile([]models.Entry{named}, Options{}, ProfileOptions{}, "HK")
+
+	for _, line := range []string{
+		"HK = select, HK 2, HK 3",
+		"HK 2 = url-test, HK 3, url = http://www.gstatic.com/generate_204, interval = 600",
+		"FINAL, HK",
+	} {
+		if !strings.Contains(profile, line+"\n") {
+			t.Errorf("profile is missing %q:\n%s", line, profile)
+		}
+	}
+}
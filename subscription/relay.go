@@ -0,0 +1,103 @@
+/*
+ * @Author: Vincent Yang
+ * @Date: 2026-10-18 02:26:14
+ * @LastEditors: Vincent Yang
+ * @LastEditTime: 2026-10-18 02:26:14
+ * @FilePath: /snell-panel/subscription/relay.go
+ * @Telegram: https://t.me/missuo
+ * @GitHub: https://github.com/missuo
+ *
+ * Copyright © 2026 by Vincent, All Rights Reserved.
+ */
+
+package subscription
+
+import (
+	"snell-panel/models"
+)
+
+// relayCycles returns the node IDs of the entries whose relay chain
+// loops back on itself. Chains are validated when they are saved, this
+// only guards the output against concurrent edits.
+func relayCycles(entries []models.Entry) map[string]bool {
+	parents := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		parents[entry.NodeID] = entry.RelayNodeID
+	}
+
+	cycles := make(map[string]bool)
+	for _, entry := range entries {
+		visited := map[string]bool{entry.NodeID: true}
+		for id := parents[entry.NodeID]; id != ""; id = parents[id] {
+			if id == entry.NodeID {
+				cycles[entry.NodeID] = true
+				break
+			}
+			if visited[id] {
+				break
+			}
+			visited[id] = true
+		}
+	}
+	return cycles
+}
+
+// relayNames returns the name of the proxy each entry is dialed through,
+// given the names of the entries: its relay node when that node is part
+// of the subscription, then its relay policy, then opts.Via. An empty
+// name means the entry is dialed directly.
+func relayNames(entries []models.Entry, names []string, opts Options) []string {
+	nameByID := make(map[string]string, len(entries))
+	for i, entry := range entries {
+		nameByID[entry.NodeID] = names[i]
+	}
+	cycles := relayCycles(entries)
+
+	relays := make([]string, len(entries))
+	for i, entry := range entries {
+		parent, ok := nameByID[entry.RelayNodeID]
+		switch {
+		case entry.RelayNodeID != "" && ok && !cycles[entry.NodeID]:
+			relays[i] = parent
+		case entry.RelayPolicy != "":
+			relays[i] = entry.RelayPolicy
+		default:
+			relays[i] = opts.Via
+		}
+	}
+	return relays
+}
+
+// DropBrokenRelays drops the entries relayed through a node that is not
+// part of the list, directly or through their own relay node, as they
+// could not be dialed the way they were declared
+func DropBrokenRelays(entries []models.Entry) []models.Entry {
+	return dropRelayedThrough(entries, func(models.Entry) bool { return false })
+}
+
+// dropRelayedThrough drops the entries for which skip returns true, the
+// entries relayed through a node that is missing from the list, and
+// transitively every entry relayed through a dropped one
+func dropRelayedThrough(entries []models.Entry, skip func(models.Entry) bool) []models.Entry {
+	kept := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		kept[entry.NodeID] = !skip(entry)
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, entry := range entries {
+			if kept[entry.NodeID] && entry.RelayNodeID != "" && !kept[entry.RelayNodeID] {
+				kept[entry.NodeID] = false
+				changed = true
+			}
+		}
+	}
+
+	filtered := make([]models.Entry, 0, len(entries))
+	for _, entry := range entries {
+		if kept[entry.NodeID] {
+			filtered = append(filtered, entry)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,100 @@
+/*
+ * @Author: Vincent Yang
+ * @Date: 2026-10-17 14:20:09
+ * @LastEditors: Vincent Yang
+ * @LastEditTime: 2026-10-17 14:20:09
+ * @FilePath: /snell-panel/subscription/render.go
+ * @Telegram: https://t.me/missuo
+ * @GitHub: https://github.com/missuo
+ *
+ * Copyright © 2026 by Vincent, All Rights Reserved.
+ */
+
+package subscription
+
+import (
+	"fmt"
+
+	"snell-panel/models"
+)
+
+// Format identifies a subscription output format
+type Format string
+
+const (
+	// FormatSurge renders Surge proxy lines
+	FormatSurge Format = "surge"
+	// FormatClash renders a Mihomo (Clash Meta) proxies document
+	FormatClash Format = "clash"
+	// FormatSingBox renders sing-box outbounds
+	FormatSingBox Format = "sing-box"
+	// FormatSurgeProfile renders a complete Surge managed profile
+	FormatSurgeProfile Format = "surge-profile"
+)
+
+// ParseFormat converts a format query parameter into a Format,
+// accepting the common aliases of each format
+func ParseFormat(format string) (Format, error) {
+	switch format {
+	case "", "surge":
+		return FormatSurge, nil
+	case "clash", "mihomo":
+		return FormatClash, nil
+	case "sing-box", "singbox":
+		return FormatSingBox, nil
+	case "surge-profile":
+		return FormatSurgeProfile, nil
+	default:
+		return "", fmt.Errorf("unsupported subscription format: %s", format)
+	}
+}
+
+// Request describes a subscription to generate
+type Request struct {
+	Options
+	// Format is the output format
+	Format Format
+	// Filter only includes nodes whose name contains the keyword
+	Filter string
+	// Tags only includes nodes carrying at least one tag of every clause
+	Tags [][]string
+	// ExcludeTags drops nodes carrying any of the tags
+	ExcludeTags []string
+	// Group names the policy group wrapping every node, if supported by the format
+	Group string
+	// HealthyOnly drops nodes that have been unreachable for too long,
+	// nil uses the server-wide default
+	HealthyOnly *bool
+	// Profile controls the managed profile header of FormatSurgeProfile
+	Profile ProfileOptions
+}
+
+// Document is a rendered subscription
+type Document struct {
+	ContentType string
+	Body        []byte
+}
+
+// Render renders entries in the requested format
+func Render(entries []models.Entry, req Request) (*Document, error) {
+	switch req.Format {
+	case FormatClash:
+		body, err := Clash(entries, req.Options, req.Group)
+		if err != nil {
+			return nil, err
+		}
+		return &Document{ContentType: "text/yaml; charset=utf-8", Body: body}, nil
+	case FormatSingBox:
+		body, err := SingBox(entries, req.Options, req.Group)
+		if err != nil {
+			return nil, err
+		}
+		return &Document{ContentType: "application/json; charset=utf-8", Body: body}, nil
+	case FormatSurgeProfile:
+		body := SurgeProfile(entries, req.Options, req.Profile, req.Group)
+		return &Document{ContentType: "text/plain; charset=utf-8", Body: []byte(body)}, nil
+	default:
+		body := Surge(entries, req.Options)
+		return &Document{ContentType: "text/plain; charset=utf-8", Body: []byte(body)}, nil
+	}
+}
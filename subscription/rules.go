@@ -0,0 +1,167 @@
+/*
+ * @Author: Vincent Yang
+ * @Date: 2026-10-18 01:38:50
+ * @LastEditors: Vincent Yang
+ * @LastEditTime: 2026-10-18 01:38:50
+ * @FilePath: /snell-panel/subscription/rules.go
+ * @Telegram: https://t.me/missuo
+ * @GitHub: https://github.com/missuo
+ *
+ * Copyright © 2026 by Vincent, All Rights Reserved.
+ */
+
+package subscription
+
+import (
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"strconv"
+	"strings"
+
+	"snell-panel/models"
+)
+
+// Go regular expressions run in linear time, so no pattern can backtrack
+// catastrophically. These limits bound the remaining cost of a pattern,
+// its size, which grows with nested repetitions.
+const (
+	// maxPatternLength is the longest pattern in bytes
+	maxPatternLength = 256
+	// maxPatternRepeat caps the product of nested repetition counts
+	maxPatternRepeat = 1000
+	// maxRenameRules is the most rename rules a subscription may apply
+	maxRenameRules = 32
+)
+
+// Rules selects nodes and rewrites their names with regular expressions
+type Rules struct {
+	// Include keeps only the nodes matching the pattern, if set
+	Include *regexp.Regexp
+	// Exclude drops the nodes matching the pattern, if set
+	Exclude *regexp.Regexp
+	// Rename is applied to node names in order
+	Rename []RenameRule
+}
+
+// RenameRule is a compiled models.RenameRule
+type RenameRule struct {
+	Pattern     *regexp.Regexp
+	Replacement string
+}
+
+// CompilePattern compiles an include or exclude pattern, rejecting
+// patterns that are too long or repeat too much. An empty pattern
+// returns nil.
+func CompilePattern(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	if len(pattern) > maxPatternLength {
+		return nil, fmt.Errorf("pattern must be at most %d bytes", maxPatternLength)
+	}
+	parsed, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return nil, err
+	}
+	if repeatWeight(parsed) > maxPatternRepeat {
+		return nil, fmt.Errorf("pattern repeats too much, nested repetitions may match at most %d times", maxPatternRepeat)
+	}
+	return regexp.Compile(pattern)
+}
+
+// repeatWeight returns the product of the repetition counts along the
+// most deeply repeated path of a pattern, counting unbounded repetitions
+// once
+func repeatWeight(re *syntax.Regexp) int {
+	weight := 1
+	for _, sub := range re.Sub {
+		if w := repeatWeight(sub); w > weight {
+			weight = w
+		}
+	}
+	if re.Op == syntax.OpRepeat {
+		count := re.Max
+		if count < 0 {
+			count = re.Min
+		}
+		if count > 1 {
+			weight *= count
+		}
+	}
+	return weight
+}
+
+// CompileRename compiles rename rules in order
+func CompileRename(rules []models.RenameRule) ([]RenameRule, error) {
+	if len(rules) > maxRenameRules {
+		return nil, fmt.Errorf("at most %d rename rules are allowed", maxRenameRules)
+	}
+	compiled := make([]RenameRule, 0, len(rules))
+	for i, rule := range rules {
+		if rule.Pattern == "" {
+			return nil, fmt.Errorf("rule %d: pattern is required", i+1)
+		}
+		pattern, err := CompilePattern(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i+1, err)
+		}
+		if len(rule.Replacement) > maxPatternLength {
+			return nil, fmt.Errorf("rule %d: replacement must be at most %d bytes", i+1, maxPatternLength)
+		}
+		compiled = append(compiled, RenameRule{Pattern: pattern, Replacement: rule.Replacement})
+	}
+	return compiled, nil
+}
+
+// ParseRenameRule parses a rename rule written as "pattern=>replacement"
+func ParseRenameRule(rule string) (models.RenameRule, error) {
+	pattern, replacement, ok := strings.Cut(rule, "=>")
+	if !ok {
+		return models.RenameRule{}, fmt.Errorf("rename rule %q must be written as pattern=>replacement", rule)
+	}
+	return models.RenameRule{Pattern: pattern, Replacement: replacement}, nil
+}
+
+// rename applies the rename rules to a node name. A rule whose result
+// would be empty or too long is skipped.
+func (r Rules) rename(name string) string {
+	for _, rule := range r.Rename {
+		renamed := strings.Join(strings.Fields(nameSanitizer.Replace(
+			rule.Pattern.ReplaceAllString(name, rule.Replacement))), " ")
+		if renamed != "" && len(renamed) <= maxNameLength {
+			name = renamed
+		}
+	}
+	return name
+}
+
+// matches reports whether a pattern matches the rendered name, country
+// code, ISP or AS number of a node
+func matches(pattern *regexp.Regexp, entry models.Entry, name string) bool {
+	return pattern.MatchString(name) ||
+		pattern.MatchString(entry.CountryCode) ||
+		pattern.MatchString(entry.ISP) ||
+		pattern.MatchString("AS"+strconv.Itoa(entry.ASN))
+}
+
+// FilterRules drops the entries that the include and exclude patterns of
+// opts reject, matching them against their renamed node name without the
+// via suffix
+func FilterRules(entries []models.Entry, opts Options) []models.Entry {
+	if opts.Rules.Include == nil && opts.Rules.Exclude == nil {
+		return entries
+	}
+	filtered := entries[:0]
+	for _, entry := range entries {
+		name := baseName(entry, opts)
+		if opts.Rules.Include != nil && !matches(opts.Rules.Include, entry, name) {
+			continue
+		}
+		if opts.Rules.Exclude != nil && matches(opts.Rules.Exclude, entry, name) {
+			continue
+		}
+		filtered = append(filtered, entry)
+	}
+	return filtered
+}
@@ -0,0 +1,145 @@
+/*
+ * @Author: Vincent Yang
+ * @Date: 2026-10-17 11:02:18
+ * @LastEditors: Vincent Yang
+ * @LastEditTime: 2026-10-17 11:02:18
+ * @FilePath: /snell-panel/subscription/singbox.go
+ * @Telegram: https://t.me/missuo
+ * @GitHub: https://github.com/missuo
+ *
+ * Copyright © 2026 by Vincent, All Rights Reserved.
+ */
+
+package subscription
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"snell-panel/models"
+)
+
+const (
+	// singBoxSelectorTag is the default tag of the generated selector outbound
+	singBoxSelectorTag = "proxy"
+	// singBoxURLTestTag is the tag of the generated urltest outbound
+	singBoxURLTestTag = "auto"
+	// singBoxURLTestURL is the URL probed by the urltest outbound
+	singBoxURLTestURL = "https://www.gstatic.com/generate_204"
+	// singBoxURLTestInterval is how often the urltest outbound probes nodes
+	singBoxURLTestInterval = "3m"
+	// singBoxShadowTLSSuffix is appended to a node tag to name its shadowtls outbound
+	singBoxShadowTLSSuffix = " (shadowtls)"
+)
+
+// singBoxOutbound represents an outbound in a sing-box configuration
+type singBoxOutbound struct {
+	Type       string           `json:"type"`
+	Tag        string           `json:"tag"`
+	Server     string           `json:"server,omitempty"`
+	ServerPort int              `json:"server_port,omitempty"`
+	PSK        string           `json:"psk,omitempty"`
+	Version    int              `json:"version,omitempty"`
+	Password   string           `json:"password,omitempty"`
+	ObfsOpts   *singBoxObfsOpts `json:"obfs_opts,omitempty"`
+	TLS        *singBoxTLS      `json:"tls,omitempty"`
+	Detour     string           `json:"detour,omitempty"`
+	Outbounds  []string         `json:"outbounds,omitempty"`
+	Default    string           `json:"default,omitempty"`
+	URL        string           `json:"url,omitempty"`
+	Interval   string           `json:"interval,omitempty"`
+}
+
+// singBoxObfsOpts represents the obfuscation options of a snell outbound
+type singBoxObfsOpts struct {
+	Mode string `json:"mode"`
+	Host string `json:"host,omitempty"`
+}
+
+// singBoxTLS represents the TLS options of a shadowtls outbound
+type singBoxTLS struct {
+	Enabled    bool   `json:"enabled"`
+	ServerName string `json:"server_name"`
+}
+
+// singBoxConfig represents the subset of a sing-box configuration we generate
+type singBoxConfig struct {
+	Outbounds []singBoxOutbound `json:"outbounds"`
+}
+
+// SingBox renders entries as sing-box outbounds wrapped in a selector
+// and a urltest outbound. The selector is tagged with group, or "proxy"
+// when group is empty, and defaults to the urltest outbound. Nodes
+// fronted by ShadowTLS get a shadowtls outbound they are dialed through.
+//
+// Upstream sing-box has no snell outbound, so the output needs a build
+// that adds one. Only the dial fields every current sing-box release
+// accepts are written: the IP version is applied by writing the address
+// of that family as the server, and TFO is left to the client.
+func SingBox(entries []models.Entry, opts Options, group string) ([]byte, error) {
+	if group == "" {
+		group = singBoxSelectorTag
+	}
+
+	var names []string
+	var nodes []singBoxOutbound
+	nodeNames := NodeNames(entries, opts)
+	relays := relayNames(entries, nodeNames, opts)
+	for i, entry := range entries {
+		nodeName := nodeNames[i]
+
+		version, _ := strconv.Atoi(entry.Version)
+
+		node := singBoxOutbound{
+			Type:       "snell",
+			Tag:        nodeName,
+			Server:     ServerAddress(entry, opts.IPVersion),
+			ServerPort: entry.Port,
+			PSK:        entry.PSK,
+			Version:    version,
+			Detour:     relays[i],
+		}
+		if entry.Obfs != "" {
+			node.ObfsOpts = &singBoxObfsOpts{Mode: entry.Obfs, Host: entry.ObfsHost}
+		}
+		if entry.UsesShadowTLS() {
+			// The snell outbound is dialed through the shadowtls outbound,
+			// which takes over the relay and dial options
+			shadowTLS := singBoxOutbound{
+				Type:       "shadowtls",
+				Tag:        nodeName + singBoxShadowTLSSuffix,
+				Server:     node.Server,
+				ServerPort: entry.ServerPort(),
+				Version:    entry.ShadowTLSVersion,
+				Password:   entry.ShadowTLSPassword,
+				TLS:        &singBoxTLS{Enabled: true, ServerName: entry.ShadowTLSSNI},
+				Detour:     node.Detour,
+			}
+			node.Detour = shadowTLS.Tag
+			nodes = append(nodes, shadowTLS)
+		}
+		nodes = append(nodes, node)
+		names = append(names, nodeName)
+	}
+
+	config := singBoxConfig{
+		Outbounds: []singBoxOutbound{
+			{
+				Type:      "selector",
+				Tag:       group,
+				Outbounds: append([]string{singBoxURLTestTag}, names...),
+				Default:   singBoxURLTestTag,
+			},
+			{
+				Type:      "urltest",
+				Tag:       singBoxURLTestTag,
+				Outbounds: names,
+				URL:       singBoxURLTestURL,
+				Interval:  singBoxURLTestInterval,
+			},
+		},
+	}
+	config.Outbounds = append(config.Outbounds, nodes...)
+
+	return json.MarshalIndent(config, "", "  ")
+}
@@ -0,0 +1,111 @@
+/*
+ * @Author: Vincent Yang
+ * @Date: 2026-10-17 10:12:46
+ * @LastEditors: Vincent Yang
+ * @LastEditTime: 2026-10-17 10:12:46
+ * @FilePath: /snell-panel/subscription/singbox_test.go
+ * @Telegram: https://t.me/missuo
+ * @GitHub: https://github.com/missuo
+ *
+ * Copyright © 2026 by Vincent, All Rights Reserved.
+ */
+
+package subscription
+
+import (
+	"strings"
+	"testing"
+
+	"snell-panel/models"
+)
+
+func TestSingBox(t *testing.T) {
+	hk := testEntry("node-hk", "HK")
+	hk.Obfs, hk.ObfsHost, hk.TFO = models.ObfsTLS, "example.com", true
+	shadowTLS := testEntry("node-stls", "STLS")
+	shadowTLS.ShadowTLSPassword, shadowTLS.ShadowTLSSNI, shadowTLS.ShadowTLSVersion, shadowTLS.ShadowTLSPort = "pw", "apple.com", 3, 8443
+	shadowTLS.RelayNodeID = hk.NodeID
+
+	body, err := SingBox([]models.Entry{hk, shadowTLS}, Options{IPVersion: IPVersion6, Via: "Home"}, "")
+	if err != nil {
+		t.Fatalf("SingBox() error = %v", err)
+	}
+	want := `{
+  "outbounds": [
+    {
+      "type": "selector",
+      "tag": "proxy",
+      "outbounds": [
+        "auto",
+        "HK - Home",
+        "STLS - Home"
+      ],
+      "default": "auto"
+    },
+    {
+      "type": "urltest",
+      "tag": "auto",
+      "outbounds": [
+        "HK - Home",
+        "STLS - Home"
+      ],
+      "url": "https://www.gstatic.com/generate_204",
+      "interval": "3m"
+    },
+    {
+      "type": "snell",
+      "tag": "HK - Home",
+      "server": "2606:4700::1111",
+      "server_port": 443,
+      "psk": "secret",
+      "version": 4,
+      "obfs_opts": {
+        "mode": "tls",
+        "host": "example.com"
+      },
+      "detour": "Home"
+    },
+    {
+      "type": "shadowtls",
+      "tag": "STLS - Home (shadowtls)",
+      "server": "2606:4700::1111",
+      "server_port": 8443,
+      "version": 3,
+      "password": "pw",
+      "tls": {
+        "enabled": true,
+        "server_name": "apple.com"
+      },
+      "detour": "HK - Home"
+    },
+    {
+      "type": "snell",
+      "tag": "STLS - Home",
+      "server": "2606:4700::1111",
+      "server_port": 443,
+      "psk": "secret",
+      "version": 4,
+      "detour": "STLS - Home (shadowtls)"
+    }
+  ]
+}`
+	if string(body) != want {
+		t.Errorf("SingBox() =\n%s\nwant\n%s", body, want)
+	}
+}
+
+func TestSingBoxDeprecatedFields(t *testing.T) {
+	tuned := testEntry("node-1", "HK")
+	tuned.TFO = true
+	for _, version := range []IPVersion{IPVersion4, IPVersion6, IPVersionDual} {
+		body, err := SingBox([]models.Entry{tuned}, Options{IPVersion: version}, "")
+		if err != nil {
+			t.Fatalf("SingBox() error = %v", err)
+		}
+		for _, field := range []string{"tcp_fast_open", "domain_strategy"} {
+			if strings.Contains(string(body), field) {
+				t.Errorf("SingBox() with ip_version %q writes the deprecated %s field", version, field)
+			}
+		}
+	}
+}
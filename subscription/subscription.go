@@ -0,0 +1,142 @@
+/*
+ * @Author: Vincent Yang
+ * @Date: 2026-10-17 10:12:40
+ * @LastEditors: Vincent Yang
+ * @LastEditTime: 2026-10-17 10:12:40
+ * @FilePath: /snell-panel/subscription/subscription.go
+ * @Telegram: https://t.me/missuo
+ * @GitHub: https://github.com/missuo
+ *
+ * Copyright © 2026 by Vincent, All Rights Reserved.
+ */
+
+package subscription
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"snell-panel/models"
+)
+
+// IPVersion selects which address of a node a subscription connects to
+type IPVersion string
+
+const (
+	// IPVersionDefault uses the address the node was registered with
+	IPVersionDefault IPVersion = ""
+	// IPVersion4 only connects over IPv4
+	IPVersion4 IPVersion = "4"
+	// IPVersion6 only connects over IPv6
+	IPVersion6 IPVersion = "6"
+	// IPVersionDual lets the client pick either address family
+	IPVersionDual IPVersion = "dual"
+)
+
+// ParseIPVersion converts an ip_version query parameter into an IPVersion
+func ParseIPVersion(version string) (IPVersion, error) {
+	switch version {
+	case "":
+		return IPVersionDefault, nil
+	case "4", "v4", "ipv4":
+		return IPVersion4, nil
+	case "6", "v6", "ipv6":
+		return IPVersion6, nil
+	case "dual":
+		return IPVersionDual, nil
+	default:
+		return "", fmt.Errorf("unsupported ip_version: %s", version)
+	}
+}
+
+// Options controls how entries are rendered into a subscription
+type Options struct {
+	// Via is the name of the policy the nodes without a relay of their
+	// own are relayed through
+	Via string
+	// ShowFlag prefixes node names with the country flag emoji
+	ShowFlag bool
+	// IPVersion selects the address family nodes are connected over
+	IPVersion IPVersion
+	// NameTemplate renders node names, DefaultNameTemplate when nil, see
+	// ParseNameTemplate
+	NameTemplate *template.Template
+	// Rules filters nodes and rewrites their names
+	Rules Rules
+}
+
+// ServerAddress returns the address a subscription connects to for an
+// entry, or an empty string if the entry has no address of the
+// requested family
+func ServerAddress(entry models.Entry, version IPVersion) string {
+	switch version {
+	case IPVersion4:
+		return entry.IPv4
+	case IPVersion6:
+		return entry.IPv6
+	default:
+		return entry.IP
+	}
+}
+
+// FilterIPVersion drops the entries that have no address of the
+// requested family
+func FilterIPVersion(entries []models.Entry, version IPVersion) []models.Entry {
+	filtered := entries[:0]
+	for _, entry := range entries {
+		if ServerAddress(entry, version) != "" {
+			filtered = append(filtered, entry)
+		}
+	}
+	return filtered
+}
+
+// Surge renders entries as Surge proxy lines
+func Surge(entries []models.Entry, opts Options) string {
+	var subscriptionLines []string
+	names := NodeNames(entries, opts)
+	relays := relayNames(entries, names, opts)
+	for i, entry := range entries {
+		subscriptionLines = append(subscriptionLines, surgeLine(entry, names[i], relays[i], opts))
+	}
+
+	return strings.Join(subscriptionLines, "\n")
+}
+
+// surgeIPVersions maps an IPVersion to the Surge ip-version parameter
+var surgeIPVersions = map[IPVersion]string{
+	IPVersion4:    "v4-only",
+	IPVersion6:    "v6-only",
+	IPVersionDual: "dual",
+}
+
+// surgeLine renders a single entry as a Surge proxy line, dialed through
+// the relay proxy when it is not empty
+func surgeLine(entry models.Entry, nodeName, relay string, opts Options) string {
+	line := fmt.Sprintf("%s = snell, %s, %d, psk = %s, version = %s",
+		nodeName, ServerAddress(entry, opts.IPVersion), entry.ServerPort(), entry.PSK, entry.Version)
+	if entry.Obfs != "" {
+		line += ", obfs = " + entry.Obfs
+		if entry.ObfsHost != "" {
+			line += ", obfs-host = " + entry.ObfsHost
+		}
+	}
+	if entry.UsesShadowTLS() {
+		line += fmt.Sprintf(", shadow-tls-password = %s, shadow-tls-sni = %s, shadow-tls-version = %d",
+			entry.ShadowTLSPassword, entry.ShadowTLSSNI, entry.ShadowTLSVersion)
+	}
+	if entry.TFO {
+		line += ", tfo = true"
+	}
+	if entry.Reuse {
+		line += ", reuse = true"
+	}
+	if ipVersion, ok := surgeIPVersions[opts.IPVersion]; ok {
+		line += ", ip-version = " + ipVersion
+	}
+	if relay != "" {
+		line += ", underlying-proxy = " + relay
+	}
+	return line
+}
@@ -0,0 +1,166 @@
+/*
+ * @Author: Vincent Yang
+ * @Date: 2026-10-18 18:05:41
+ * @LastEditors: Vincent Yang
+ * @LastEditTime: 2026-10-18 18:05:41
+ * @FilePath: /snell-panel/subscription/subscription_test.go
+ * @Telegram: https://t.me/missuo
+ * @GitHub: https://github.com/missuo
+ *
+ * Copyright © 2026 by Vincent, All Rights Reserved.
+ */
+
+package subscription
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"snell-panel/models"
+)
+
+// testEntry returns a snell v4 node in Hong Kong
+func testEntry(nodeID, name string) models.Entry {
+	return models.Entry{
+		IP: "1.1.1.1", IPv4: "1.1.1.1", IPv6: "2606:4700::1111", Port: 443, PSK: "secret", Version: "4",
+		CountryCode: "HK", ISP: "Cloudflare", ASN: 13335, NodeID: nodeID, NodeName: name,
+	}
+}
+
+func TestSurge(t *testing.T) {
+	obfs := testEntry("node-obfs", "Obfs")
+	obfs.Obfs, obfs.ObfsHost = models.ObfsTLS, "example.com"
+	shadowTLS := testEntry("node-stls", "STLS")
+	shadowTLS.ShadowTLSPassword, shadowTLS.ShadowTLSSNI, shadowTLS.ShadowTLSVersion, shadowTLS.ShadowTLSPort = "pw", "apple.com", 3, 8443
+	tuned := testEntry("node-tuned", "Tuned")
+	tuned.TFO, tuned.Reuse = true, true
+
+	tests := []struct {
+		name    string
+		entries []models.Entry
+		opts    Options
+		want    string
+	}{
+		{
+			name:    "plain node",
+			entries: []models.Entry{testEntry("node-1", "HK")},
+			want:    "HK = snell, 1.1.1.1, 443, psk = secret, version = 4",
+		},
+		{
+			name:    "flag and via",
+			entries: []models.Entry{testEntry("node-1", "HK")},
+			opts:    Options{ShowFlag: true, Via: "Relay"},
+			want:    "🇭🇰 HK - Relay = snell, 1.1.1.1, 443, psk = secret, version = 4, underlying-proxy = Relay",
+		},
+		{
+			name:    "unnamed node keeps its full node ID",
+			entries: []models.Entry{testEntry("0f1e2d3c-4b5a-6978-8796-a5b4c3d2e1f0", "")},
+			want:    "HK AS13335 Cloudflare 0f1e2d3c-4b5a-6978-8796-a5b4c3d2e1f0 = snell, 1.1.1.1, 443, psk = secret, version = 4",
+		},
+		{
+			name:    "obfs",
+			entries: []models.Entry{obfs},
+			want:    "Obfs = snell, 1.1.1.1, 443, psk = secret, version = 4, obfs = tls, obfs-host = example.com",
+		},
+		{
+			name:    "shadow-tls dials its own port",
+			entries: []models.Entry{shadowTLS},
+			want:    "STLS = snell, 1.1.1.1, 8443, psk = secret, version = 4, shadow-tls-password = pw, shadow-tls-sni = apple.com, shadow-tls-version = 3",
+		},
+		{
+			name:    "tfo and reuse",
+			entries: []models.Entry{tuned},
+			want:    "Tuned = snell, 1.1.1.1, 443, psk = secret, version = 4, tfo = true, reuse = true",
+		},
+		{
+			name:    "ipv6 only",
+			entries: []models.Entry{testEntry("node-1", "HK")},
+			opts:    Options{IPVersion: IPVersion6},
+			want:    "HK = snell, 2606:4700::1111, 443, psk = secret, version = 4, ip-version = v6-only",
+		},
+		{
+			name:    "duplicate names are numbered",
+			entries: []models.Entry{testEntry("node-1", "HK"), testEntry("node-2", "HK")},
+			want: "HK = snell, 1.1.1.1, 443, psk = secret, version = 4\n" +
+				"HK 2 = snell, 1.1.1.1, 443, psk = secret, version = 4",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Surge(tt.entries, tt.opts); got != tt.want {
+				t.Errorf("Surge() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSurgeRelays(t *testing.T) {
+	entry := testEntry("node-entry", "Entry")
+	exit := testEntry("node-exit", "Exit")
+	exit.RelayNodeID = entry.NodeID
+	policy := testEntry("node-policy", "Policy")
+	policy.RelayPolicy = "Office"
+
+	lines := strings.Split(Surge([]models.Entry{entry, exit, policy}, Options{Via: "Home"}), "\n")
+	want := []string{
+		"Entry - Home = snell, 1.1.1.1, 443, psk = secret, version = 4, underlying-proxy = Home",
+		"Exit - Home = snell, 1.1.1.1, 443, psk = secret, version = 4, underlying-proxy = Entry - Home",
+		"Policy - Home = snell, 1.1.1.1, 443, psk = secret, version = 4, underlying-proxy = Office",
+	}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Surge() =\n%s\nwant\n%s", strings.Join(lines, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestDropBrokenRelays(t *testing.T) {
+	entry := testEntry("node-entry", "Entry")
+	exit := testEntry("node-exit", "Exit")
+	exit.RelayNodeID = entry.NodeID
+	last := testEntry("node-last", "Last")
+	last.RelayNodeID = exit.NodeID
+
+	kept := DropBrokenRelays([]models.Entry{exit, last})
+	if len(kept) != 0 {
+		t.Errorf("DropBrokenRelays() kept %d entries, want the whole chain dropped with its missing entry node", len(kept))
+	}
+	kept = DropBrokenRelays([]models.Entry{entry, exit, last})
+	if len(kept) != 3 {
+		t.Errorf("DropBrokenRelays() kept %d entries of a complete chain, want 3", len(kept))
+	}
+}
+
+func TestFilterRules(t *testing.T) {
+	hk := testEntry("node-hk", "HK IPLC")
+	jp := testEntry("node-jp", "JP")
+	jp.CountryCode = "JP"
+
+	tests := []struct {
+		name    string
+		rules   Rules
+		via     string
+		wantIDs []string
+	}{
+		{name: "include by name", rules: Rules{Include: regexp.MustCompile("IPLC")}, wantIDs: []string{"node-hk"}},
+		{name: "include by country", rules: Rules{Include: regexp.MustCompile("^JP$")}, wantIDs: []string{"node-jp"}},
+		{name: "exclude", rules: Rules{Exclude: regexp.MustCompile("IPLC")}, wantIDs: []string{"node-jp"}},
+		{name: "exclude ignores the via suffix", rules: Rules{Exclude: regexp.MustCompile("Relay")}, via: "Relay", wantIDs: []string{"node-hk", "node-jp"}},
+		{
+			name:    "rules match renamed nodes",
+			rules:   Rules{Include: regexp.MustCompile("^Hong Kong"), Rename: []RenameRule{{Pattern: regexp.MustCompile("^HK"), Replacement: "Hong Kong"}}},
+			wantIDs: []string{"node-hk"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filtered := FilterRules([]models.Entry{hk, jp}, Options{Rules: tt.rules, Via: tt.via})
+			var ids []string
+			for _, entry := range filtered {
+				ids = append(ids, entry.NodeID)
+			}
+			if strings.Join(ids, ",") != strings.Join(tt.wantIDs, ",") {
+				t.Errorf("FilterRules() kept %v, want %v", ids, tt.wantIDs)
+			}
+		})
+	}
+}
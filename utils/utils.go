@@ -13,15 +13,16 @@
 package utils
 
 import (
-	"encoding/json"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
-	"io"
 	"net"
-	"net/http"
+	"net/netip"
+	"slices"
 	"strings"
 
-	"snell-panel/models"
-
 	"github.com/google/uuid"
 )
 
@@ -30,36 +31,28 @@ func GenerateUUID() string {
 	return uuid.New().String()
 }
 
-// GetIPInfo retrieves geolocation information for an IP address
-func GetIPInfo(ip string) (models.GeoIP, error) {
-	url := fmt.Sprintf("https://api.ip.sb/geoip/%s", ip)
-
-	client := &http.Client{}
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return models.GeoIP{}, err
-	}
-
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/128.0.0.0 Safari/537.36")
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return models.GeoIP{}, err
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return models.GeoIP{}, err
+// GenerateToken generates a random API token secret
+func GenerateToken() (string, error) {
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
 	}
+	return "snp_" + hex.EncodeToString(secret), nil
+}
 
-	var geoIP models.GeoIP
-	err = json.Unmarshal(body, &geoIP)
-	if err != nil {
-		return models.GeoIP{}, err
+// GenerateSlug generates a random URL-safe identifier that cannot be guessed
+func GenerateSlug() (string, error) {
+	slug := make([]byte, 24)
+	if _, err := rand.Read(slug); err != nil {
+		return "", err
 	}
+	return base64.RawURLEncoding.EncodeToString(slug), nil
+}
 
-	return geoIP, nil
+// HashToken returns the SHA-256 hex digest of an API token secret
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
 
 // CountryCodeToFlagEmoji converts a country code to a flag emoji
@@ -87,49 +80,31 @@ func IsValidIP(addr string) bool {
 	return net.ParseIP(addr) != nil
 }
 
-// ResolveDomainToIP resolves a domain name to an IP address
-func ResolveDomainToIP(domain string) (string, error) {
-	// Check if it's already an IP address
-	if IsValidIP(domain) {
-		return domain, nil
-	}
-
-	// Resolve domain to IP addresses
+// ResolveDomain resolves a domain name to all of its IP addresses,
+// sorted with IPv4 addresses first so that round-robin DNS answers
+// compare equal from one lookup to the next
+func ResolveDomain(domain string) ([]string, error) {
 	ips, err := net.LookupIP(domain)
 	if err != nil {
-		return "", fmt.Errorf("failed to resolve domain %s: %w", domain, err)
-	}
-
-	// Find the first IPv4 address
-	for _, ip := range ips {
-		if ipv4 := ip.To4(); ipv4 != nil {
-			return ipv4.String(), nil
-		}
+		return nil, fmt.Errorf("failed to resolve domain %s: %w", domain, err)
 	}
 
-	// If no IPv4 found, try IPv6
+	var parsed []netip.Addr
 	for _, ip := range ips {
-		if ipv6 := ip.To16(); ipv6 != nil {
-			return ipv6.String(), nil
+		if addr, ok := netip.AddrFromSlice(ip); ok {
+			parsed = append(parsed, addr.Unmap())
 		}
 	}
-
-	return "", fmt.Errorf("no valid IP address found for domain %s", domain)
-}
-
-// GetIPInfoFromDomainOrIP resolves domain to IP if needed and gets geolocation info
-func GetIPInfoFromDomainOrIP(domainOrIP string) (string, models.GeoIP, error) {
-	// Resolve domain to IP if necessary
-	resolvedIP, err := ResolveDomainToIP(domainOrIP)
-	if err != nil {
-		return "", models.GeoIP{}, err
+	if len(parsed) == 0 {
+		return nil, fmt.Errorf("no valid IP address found for domain %s", domain)
 	}
+	// Compare orders IPv4 addresses before IPv6 addresses
+	slices.SortFunc(parsed, netip.Addr.Compare)
+	parsed = slices.Compact(parsed)
 
-	// Get IP geolocation information
-	geoIP, err := GetIPInfo(resolvedIP)
-	if err != nil {
-		return resolvedIP, models.GeoIP{}, err
+	addrs := make([]string, len(parsed))
+	for i, addr := range parsed {
+		addrs[i] = addr.String()
 	}
-
-	return resolvedIP, geoIP, nil
+	return addrs, nil
 }
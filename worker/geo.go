@@ -0,0 +1,122 @@
+/*
+ * @Author: Vincent Yang
+ * @Date: 2026-10-17 19:34:48
+ * @LastEditors: Vincent Yang
+ * @LastEditTime: 2026-10-17 19:34:48
+ * @FilePath: /snell-panel/worker/geo.go
+ * @Telegram: https://t.me/missuo
+ * @GitHub: https://github.com/missuo
+ *
+ * Copyright © 2026 by Vincent, All Rights Reserved.
+ */
+
+package worker
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"snell-panel/database"
+	"snell-panel/geoip"
+	"snell-panel/models"
+)
+
+// maxGeoBackoff caps the delay between two lookups of the same entry
+const maxGeoBackoff = time.Hour
+
+// GeoEnricher retries the geolocation lookups that failed when entries
+// were created or modified
+type GeoEnricher struct {
+	Repo        database.Repository
+	Geo         geoip.Provider
+	Interval    time.Duration
+	MaxAttempts int
+}
+
+// NewGeoEnricher creates a new GeoEnricher instance
+func NewGeoEnricher(repo database.Repository, geo geoip.Provider, interval time.Duration, maxAttempts int) *GeoEnricher {
+	return &GeoEnricher{
+		Repo:        repo,
+		Geo:         geo,
+		Interval:    interval,
+		MaxAttempts: maxAttempts,
+	}
+}
+
+// Run retries the due lookups immediately and then once per interval
+// until the context is cancelled
+func (g *GeoEnricher) Run(ctx context.Context) {
+	ticker := time.NewTicker(g.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := g.EnrichPending(ctx); err != nil {
+			log.Printf("Geo enricher failed to list pending entries: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// EnrichPending retries every pending lookup that is due, stopping early
+// when the context is done
+func (g *GeoEnricher) EnrichPending(ctx context.Context) error {
+	entries, err := g.Repo.ListGeoPending(time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	for i := range entries {
+		if ctx.Err() != nil {
+			return nil
+		}
+		g.enrich(&entries[i])
+	}
+	return nil
+}
+
+// enrich looks up one entry and saves the outcome. Entries that keep
+// failing are retried with exponential backoff and given up after
+// MaxAttempts lookups.
+func (g *GeoEnricher) enrich(entry *models.Entry) {
+	err := geoip.ResolveAddresses(entry)
+	if err == nil {
+		err = geoip.Locate(g.Geo, entry)
+	}
+	if err != nil {
+		entry.SetGeoPending(err, time.Now().UTC().Add(g.backoff(entry.GeoAttempts+1)))
+		if entry.GeoAttempts >= g.MaxAttempts {
+			entry.GeoStatus = models.GeoStatusFailed
+			entry.GeoRetryAt = nil
+			log.Printf("Giving up geolocation of node %s after %d attempts: %v", entry.NodeID, entry.GeoAttempts, err)
+		}
+	}
+
+	err = g.Repo.SaveGeo(entry)
+	if errors.Is(err, models.ErrNotFound) {
+		// The entry was deleted or readdressed while we were looking it up
+		return
+	}
+	if err != nil {
+		log.Printf("Geo enricher failed to save node %s: %v", entry.NodeID, err)
+	}
+}
+
+// backoff returns the delay before retrying an entry that has failed
+// the given number of lookups
+func (g *GeoEnricher) backoff(attempts int) time.Duration {
+	delay := g.Interval
+	for i := 1; i < attempts && delay < maxGeoBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxGeoBackoff {
+		delay = maxGeoBackoff
+	}
+	return delay
+}
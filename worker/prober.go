@@ -0,0 +1,126 @@
+/*
+ * @Author: Vincent Yang
+ * @Date: 2026-10-17 17:34:56
+ * @LastEditors: Vincent Yang
+ * @LastEditTime: 2026-10-17 17:34:56
+ * @FilePath: /snell-panel/worker/prober.go
+ * @Telegram: https://t.me/missuo
+ * @GitHub: https://github.com/missuo
+ *
+ * Copyright © 2026 by Vincent, All Rights Reserved.
+ */
+
+package worker
+
+import (
+	"context"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"snell-panel/database"
+	"snell-panel/models"
+)
+
+// proberConcurrency caps how many nodes are probed at the same time
+const proberConcurrency = 16
+
+// Prober periodically opens TCP connections to every node and records
+// reachability and connect latency
+type Prober struct {
+	Repo     database.Repository
+	Interval time.Duration
+	Timeout  time.Duration
+}
+
+// NewProber creates a new Prober instance
+func NewProber(repo database.Repository, interval, timeout time.Duration) *Prober {
+	return &Prober{
+		Repo:     repo,
+		Interval: interval,
+		Timeout:  timeout,
+	}
+}
+
+// Run probes every node immediately and then once per interval until
+// the context is cancelled
+func (p *Prober) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := p.ProbeAll(ctx); err != nil {
+			log.Printf("Prober failed to list entries: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProbeAll probes every node once and records the results. Nodes left
+// when the context is done are not probed, and probes it interrupted are
+// not recorded.
+func (p *Prober) ProbeAll(ctx context.Context) error {
+	entries, err := p.Repo.List()
+	if err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, proberConcurrency)
+	for _, entry := range entries {
+		slots <- struct{}{}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(entry models.Entry) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			status := p.probe(ctx, entry)
+			if ctx.Err() != nil {
+				return
+			}
+			if err := p.Repo.SaveNodeStatus(status); err != nil {
+				log.Printf("Prober failed to save status of node %s: %v", entry.NodeID, err)
+			}
+		}(entry)
+	}
+	wg.Wait()
+	return nil
+}
+
+// probe opens a TCP connection to a node and reports the outcome
+func (p *Prober) probe(ctx context.Context, entry models.Entry) *models.NodeStatus {
+	dialer := net.Dialer{Timeout: p.Timeout}
+	address := net.JoinHostPort(entry.IP, strconv.Itoa(entry.ServerPort()))
+
+	start := time.Now()
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	elapsed := time.Since(start)
+	now := time.Now().UTC()
+
+	status := &models.NodeStatus{
+		NodeID:      entry.NodeID,
+		LastChecked: now,
+	}
+	if err != nil {
+		status.Status = models.NodeStatusDown
+		status.LastError = err.Error()
+		return status
+	}
+	conn.Close()
+
+	latencyMs := int(elapsed.Milliseconds())
+	status.Status = models.NodeStatusUp
+	status.LatencyMs = &latencyMs
+	status.LastSeen = &now
+	return status
+}
@@ -0,0 +1,141 @@
+/*
+ * @Author: Vincent Yang
+ * @Date: 2026-10-17 20:18:42
+ * @LastEditors: Vincent Yang
+ * @LastEditTime: 2026-10-17 20:18:42
+ * @FilePath: /snell-panel/worker/resolver.go
+ * @Telegram: https://t.me/missuo
+ * @GitHub: https://github.com/missuo
+ *
+ * Copyright © 2026 by Vincent, All Rights Reserved.
+ */
+
+package worker
+
+import (
+	"context"
+	"errors"
+	"log"
+	"slices"
+	"time"
+
+	"snell-panel/database"
+	"snell-panel/geoip"
+	"snell-panel/models"
+	"snell-panel/utils"
+)
+
+// Resolver periodically re-resolves the entries that store a domain and
+// refreshes their geolocation when the addresses change
+type Resolver struct {
+	Repo     database.Repository
+	Geo      geoip.Provider
+	Interval time.Duration
+}
+
+// NewResolver creates a new Resolver instance
+func NewResolver(repo database.Repository, geo geoip.Provider, interval time.Duration) *Resolver {
+	return &Resolver{
+		Repo:     repo,
+		Geo:      geo,
+		Interval: interval,
+	}
+}
+
+// Run resolves every domain entry immediately and then once per interval
+// until the context is cancelled
+func (r *Resolver) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := r.ResolveAll(ctx); err != nil {
+			log.Printf("Resolver failed to list entries: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ResolveAll resolves every domain entry once and records the changes,
+// stopping early when the context is done
+func (r *Resolver) ResolveAll(ctx context.Context) error {
+	entries, err := r.Repo.List()
+	if err != nil {
+		return err
+	}
+
+	for i := range entries {
+		if ctx.Err() != nil {
+			return nil
+		}
+		if utils.IsValidIP(entries[i].IP) {
+			continue
+		}
+		r.resolve(&entries[i])
+	}
+	return nil
+}
+
+// resolve resolves one domain entry and saves the outcome. A history
+// record is only written when the addresses change or the domain stops
+// resolving.
+func (r *Resolver) resolve(entry *models.Entry) {
+	now := time.Now().UTC()
+	addrs, err := utils.ResolveDomain(entry.IP)
+
+	var record *models.Resolution
+	if err != nil {
+		if !entry.IsUnresolvable() {
+			log.Printf("Domain %s of node %s no longer resolves: %v", entry.IP, entry.NodeID, err)
+			entry.UnresolvableSince = &now
+			record = &models.Resolution{Error: err.Error()}
+		}
+		entry.ResolveError = err.Error()
+	} else {
+		if !slices.Equal(entry.ResolvedIPs, addrs) || entry.IsUnresolvable() {
+			record = &models.Resolution{Addresses: addrs}
+		}
+		// The geolocation follows the IPv4 and IPv6 addresses, refresh it
+		// when either of them changes
+		ipv4, ipv6 := geoip.SplitAddresses(addrs)
+		if ipv4 != entry.IPv4 || ipv6 != entry.IPv6 {
+			log.Printf("Domain %s of node %s moved from [%s %s] to [%s %s]",
+				entry.IP, entry.NodeID, entry.IPv4, entry.IPv6, ipv4, ipv6)
+			entry.IPv4, entry.IPv6 = ipv4, ipv6
+			r.lookupGeo(entry, now)
+		}
+		entry.ResolvedIPs = addrs
+		entry.ResolvedAt = &now
+		entry.ResolveError = ""
+		entry.UnresolvableSince = nil
+	}
+
+	if record != nil {
+		record.NodeID = entry.NodeID
+		record.Domain = entry.IP
+		record.ResolvedAt = now
+	}
+
+	err = r.Repo.SaveResolution(entry, record)
+	if errors.Is(err, models.ErrNotFound) {
+		// The entry was deleted or readdressed while we were resolving it
+		return
+	}
+	if err != nil {
+		log.Printf("Resolver failed to save node %s: %v", entry.NodeID, err)
+	}
+}
+
+// lookupGeo refreshes the geolocation of an entry from its new addresses,
+// leaving a failed lookup to the geolocation retry worker
+func (r *Resolver) lookupGeo(entry *models.Entry, now time.Time) {
+	if err := geoip.Locate(r.Geo, entry); err != nil {
+		entry.GeoAttempts = 0
+		entry.SetGeoPending(err, now)
+	}
+}